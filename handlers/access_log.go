@@ -0,0 +1,260 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+// Formats of the access log.
+const (
+	AccessLogFormatJSON     = "json"
+	AccessLogFormatCombined = "combined"
+)
+
+const combinedTimeFormat = "02/Jan/2006:15:04:05 -0700"
+
+// AccessLog writes a line to a file for each request that Router serves.
+type AccessLog struct {
+	out         io.Writer
+	logger      zerolog.Logger
+	format      string
+	sampleRatio float64
+	statuses    map[int]bool
+	classes     map[int]bool
+}
+
+// AccessLogger is the access log, or nil if there is none.
+var AccessLogger *AccessLog
+
+// NewAccessLog returns an access log that writes to out in format, either
+// AccessLogFormatJSON or AccessLogFormatCombined. Requests with a status in
+// statuses, a comma-separated list of statuses and classes of status such as
+// "404,5xx", are always logged, and sampleRatio of the other requests are
+// logged.
+func NewAccessLog(out io.Writer, format string, sampleRatio float64, statuses string) (*AccessLog, error) {
+	if format != AccessLogFormatJSON && format != AccessLogFormatCombined {
+		return nil, fmt.Errorf("invalid access log format %q", format)
+	}
+	if sampleRatio < 0 || sampleRatio > 1 {
+		return nil, fmt.Errorf("invalid access log sample ratio %v", sampleRatio)
+	}
+
+	out = zerolog.SyncWriter(out)
+	log := &AccessLog{
+		out:         out,
+		logger:      zerolog.New(out).With().Timestamp().Logger(),
+		format:      format,
+		sampleRatio: sampleRatio,
+		statuses:    map[int]bool{},
+		classes:     map[int]bool{},
+	}
+	for _, status := range strings.Split(statuses, ",") {
+		status = strings.ToLower(strings.TrimSpace(status))
+		if status == "" {
+			continue
+		}
+		if class, ok := strings.CutSuffix(status, "xx"); ok && len(class) == 1 && class[0] >= '1' && class[0] <= '5' {
+			log.classes[int(class[0]-'0')] = true
+			continue
+		}
+		code, err := strconv.Atoi(status)
+		if err != nil || code < 100 || code > 599 {
+			return nil, fmt.Errorf("invalid access log status %q", status)
+		}
+		log.statuses[code] = true
+	}
+	return log, nil
+}
+
+// RouteInfo describes the route which served a request, for the access log.
+type RouteInfo struct {
+	Path        string
+	Prefix      bool
+	HandlerType string
+	BackendID   string
+}
+
+type accessLogKey struct{}
+
+type accessLogEntry struct {
+	route RouteInfo
+}
+
+type routeInfoHandler struct {
+	info RouteInfo
+	next http.Handler
+}
+
+// NewRouteInfoHandler returns a handler that records the route which served
+// the request in the access log and then serves it with next.
+func NewRouteInfoHandler(info RouteInfo, next http.Handler) http.Handler {
+	return &routeInfoHandler{info: info, next: next}
+}
+
+func (h *routeInfoHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if entry, ok := r.Context().Value(accessLogKey{}).(*accessLogEntry); ok {
+		entry.route = h.info
+	}
+	h.next.ServeHTTP(w, r)
+}
+
+// HandlerRouteInfo returns the route of a handler made by
+// NewRouteInfoHandler, or false if handler wasn't made by it.
+func HandlerRouteInfo(handler http.Handler) (RouteInfo, bool) {
+	h, ok := handler.(*routeInfoHandler)
+	if !ok {
+		return RouteInfo{}, false
+	}
+	return h.info, true
+}
+
+// LogAccess returns the ResponseWriter and request to serve r with, and a
+// function to call once it has been served which writes it to the access log.
+// It returns w and r themselves if there is no access log.
+func LogAccess(w http.ResponseWriter, r *http.Request) (http.ResponseWriter, *http.Request, func()) {
+	log := AccessLogger
+	if log == nil {
+		return w, r, func() {}
+	}
+
+	start := time.Now()
+	entry := &accessLogEntry{}
+	aw := &accessLogWriter{ResponseWriter: w}
+	r = r.WithContext(context.WithValue(r.Context(), accessLogKey{}, entry))
+	return aw, r, func() {
+		log.write(r, entry.route, aw.statusCode(), aw.bytes, start, time.Since(start))
+	}
+}
+
+// sampled reports whether to log a request with status.
+func (log *AccessLog) sampled(status int) bool {
+	if log.statuses[status] || log.classes[status/100] {
+		return true
+	}
+	return log.sampleRatio >= 1 || rand.Float64() < log.sampleRatio //nolint:gosec // sampling doesn't need a secure random number
+}
+
+func (log *AccessLog) write(r *http.Request, route RouteInfo, status int, bytes int64, start time.Time, duration time.Duration) {
+	if !log.sampled(status) {
+		return
+	}
+
+	if log.format == AccessLogFormatCombined {
+		bytesField := "-"
+		if bytes > 0 {
+			bytesField = strconv.FormatInt(bytes, 10)
+		}
+		client := clientIP(r)
+		if client == "" {
+			client = "-"
+		}
+		_, _ = fmt.Fprintf(log.out, "%s - - [%s] %s %d %s %s %s %s %.3f %s %s %s %s\n",
+			client,
+			start.Format(combinedTimeFormat),
+			combinedQuote(r.Method+" "+r.URL.EscapedPath()+" "+r.Proto),
+			status,
+			bytesField,
+			combinedQuote(r.Referer()),
+			combinedQuote(r.UserAgent()),
+			combinedQuote(r.Host),
+			duration.Seconds(),
+			combinedQuote(route.Path),
+			combinedQuote(route.HandlerType),
+			combinedQuote(route.BackendID),
+			combinedQuote(RequestID(r.Context())),
+		)
+		return
+	}
+
+	routeType := ""
+	if route.Path != "" {
+		routeType = "exact"
+		if route.Prefix {
+			routeType = "prefix"
+		}
+	}
+	log.logger.Info().
+		Str("method", r.Method).
+		Str("host", r.Host).
+		Str("path", r.URL.EscapedPath()).
+		Int("status", status).
+		Int64("bytes", bytes).
+		Float64("duration_seconds", duration.Seconds()).
+		Str("route", route.Path).
+		Str("route_type", routeType).
+		Str("handler_type", route.HandlerType).
+		Str("backend_id", route.BackendID).
+		Str("client_ip", clientIP(r)).
+		Str("request_id", RequestID(r.Context())).
+		Str("referer", r.Referer()).
+		Str("user_agent", r.UserAgent()).
+		Send()
+}
+
+// combinedQuote quotes s for a field of the Combined Log Format, using "-"
+// for empty values.
+func combinedQuote(s string) string {
+	if s == "" {
+		return `"-"`
+	}
+	return strconv.Quote(s)
+}
+
+// clientIP returns the IP address of the client that made r, or the empty
+// string if it isn't known.
+func clientIP(r *http.Request) string {
+	if ip := ClientIP(r); ip.IsValid() {
+		return ip.String()
+	}
+	return ""
+}
+
+type accessLogWriter struct {
+	http.ResponseWriter
+	status int
+	bytes  int64
+}
+
+func (aw *accessLogWriter) WriteHeader(code int) {
+	if aw.status == 0 && (code >= http.StatusOK || code == http.StatusSwitchingProtocols) {
+		aw.status = code
+	}
+	aw.ResponseWriter.WriteHeader(code)
+}
+
+func (aw *accessLogWriter) Write(b []byte) (int, error) {
+	if aw.status == 0 {
+		aw.status = http.StatusOK
+	}
+	n, err := aw.ResponseWriter.Write(b)
+	aw.bytes += int64(n)
+	return n, err
+}
+
+func (aw *accessLogWriter) Flush() {
+	if aw.status == 0 {
+		aw.status = http.StatusOK
+	}
+	_ = http.NewResponseController(aw.ResponseWriter).Flush()
+}
+
+func (aw *accessLogWriter) Unwrap() http.ResponseWriter {
+	return aw.ResponseWriter
+}
+
+// statusCode returns the status of the response, which is 200 if nothing was
+// written, as net/http sends that.
+func (aw *accessLogWriter) statusCode() int {
+	if aw.status == 0 {
+		return http.StatusOK
+	}
+	return aw.status
+}
@@ -0,0 +1,133 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Access log", func() {
+	var (
+		out *bytes.Buffer
+		rr  *httptest.ResponseRecorder
+		req *http.Request
+	)
+
+	BeforeEach(func() {
+		out = &bytes.Buffer{}
+		rr = httptest.NewRecorder()
+		req = httptest.NewRequest(http.MethodGet, "/government/news?q=secret", nil)
+		req.RemoteAddr = "192.0.2.1:1234"
+		req.Header.Set("User-Agent", "test-agent")
+	})
+
+	AfterEach(func() {
+		AccessLogger = nil
+	})
+
+	serve := func(handler http.Handler) {
+		req = WithRequestID(rr, req)
+		w, r, logAccess := LogAccess(rr, req)
+		handler.ServeHTTP(w, r)
+		logAccess()
+	}
+
+	backendRoute := func(status int) http.Handler {
+		info := RouteInfo{Path: "/government", Prefix: true, HandlerType: "backend", BackendID: "frontend"}
+		return NewRouteInfoHandler(info, http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+			w.WriteHeader(status)
+			_, _ = w.Write([]byte("hello"))
+		}))
+	}
+
+	It("does nothing when there is no access log", func() {
+		w, r, logAccess := LogAccess(rr, req)
+		Expect(w).To(BeIdenticalTo(rr))
+		Expect(r).To(BeIdenticalTo(req))
+		logAccess()
+	})
+
+	It("writes requests as JSON", func() {
+		var err error
+		AccessLogger, err = NewAccessLog(out, AccessLogFormatJSON, 1, "")
+		Expect(err).NotTo(HaveOccurred())
+
+		serve(backendRoute(http.StatusCreated))
+
+		var line map[string]any
+		Expect(json.Unmarshal(out.Bytes(), &line)).To(Succeed())
+		Expect(line).To(HaveKeyWithValue("method", "GET"))
+		Expect(line).To(HaveKeyWithValue("host", "example.com"))
+		Expect(line).To(HaveKeyWithValue("path", "/government/news"))
+		Expect(line).To(HaveKeyWithValue("status", 201.0))
+		Expect(line).To(HaveKeyWithValue("bytes", 5.0))
+		Expect(line).To(HaveKey("duration_seconds"))
+		Expect(line).To(HaveKeyWithValue("route", "/government"))
+		Expect(line).To(HaveKeyWithValue("route_type", "prefix"))
+		Expect(line).To(HaveKeyWithValue("handler_type", "backend"))
+		Expect(line).To(HaveKeyWithValue("backend_id", "frontend"))
+		Expect(line).To(HaveKeyWithValue("client_ip", "192.0.2.1"))
+		Expect(line).To(HaveKeyWithValue("request_id", rr.Header().Get(RequestIDHeader)))
+		Expect(line).To(HaveKeyWithValue("user_agent", "test-agent"))
+	})
+
+	It("writes requests in the Combined Log Format", func() {
+		var err error
+		AccessLogger, err = NewAccessLog(out, AccessLogFormatCombined, 1, "")
+		Expect(err).NotTo(HaveOccurred())
+
+		serve(backendRoute(http.StatusOK))
+
+		Expect(out.String()).To(MatchRegexp(
+			`^192\.0\.2\.1 - - \[[^\]]+\] "GET /government/news HTTP/1\.1" 200 5 "-" "test-agent" "example\.com" \d+\.\d{3} "/government" "backend" "frontend" "%s"\n$`,
+			rr.Header().Get(RequestIDHeader),
+		))
+	})
+
+	It("logs requests which didn't match a route with an empty route", func() {
+		var err error
+		AccessLogger, err = NewAccessLog(out, AccessLogFormatCombined, 1, "")
+		Expect(err).NotTo(HaveOccurred())
+
+		serve(http.NotFoundHandler())
+
+		Expect(out.String()).To(ContainSubstring(`" 404 19 "-" "test-agent" "example.com" `))
+		Expect(out.String()).To(MatchRegexp(` "-" "-" "-" "[^"]+"\n$`))
+	})
+
+	DescribeTable("samples requests with statuses that aren't always logged",
+		func(statuses string, status int, expectLogged bool) {
+			var err error
+			AccessLogger, err = NewAccessLog(out, AccessLogFormatJSON, 0, statuses)
+			Expect(err).NotTo(HaveOccurred())
+
+			serve(backendRoute(status))
+
+			if expectLogged {
+				Expect(out.String()).NotTo(BeEmpty())
+			} else {
+				Expect(out.String()).To(BeEmpty())
+			}
+		},
+		Entry("no statuses", "", http.StatusOK, false),
+		Entry("status in a class", "4xx, 5xx", http.StatusBadGateway, true),
+		Entry("status not in a class", "5xx", http.StatusNotFound, false),
+		Entry("listed status", "404,410", http.StatusGone, true),
+	)
+
+	DescribeTable("rejects invalid configuration",
+		func(format string, sampleRatio float64, statuses string) {
+			_, err := NewAccessLog(out, format, sampleRatio, statuses)
+			Expect(err).To(HaveOccurred())
+		},
+		Entry("unknown format", "common", 1.0, ""),
+		Entry("sample ratio above 1", AccessLogFormatJSON, 1.5, ""),
+		Entry("unknown status class", AccessLogFormatJSON, 1.0, "6xx"),
+		Entry("status out of range", AccessLogFormatJSON, 1.0, "700"),
+		Entry("not a status", AccessLogFormatJSON, 1.0, "errors"),
+	)
+})
@@ -0,0 +1,83 @@
+package handlers
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"syscall"
+)
+
+// StatusClientClosedRequest is the non-standard status code (borrowed from
+// nginx) used when the client goes away before the backend has responded.
+const StatusClientClosedRequest = 499
+
+// RouterErrorHeader is the response header which, when EnableRouterErrorHeader
+// is set, tells clients why Router generated an error response itself rather
+// than passing on a response from the backend.
+const RouterErrorHeader = "X-Router-Error"
+
+// EnableRouterErrorHeader controls whether RouterErrorHeader is added to
+// error responses generated by backend handlers.
+var EnableRouterErrorHeader bool
+
+// Reasons used to classify errors talking to backends. These are used as the
+// value of the reason label on backend metrics and of RouterErrorHeader.
+const (
+	ReasonClientCancelled     = "client_cancelled"
+	ReasonConnectionRefused   = "connection_refused"
+	ReasonConnectionReset     = "connection_reset"
+	ReasonDNSFailure          = "dns_failure"
+	ReasonTLSHandshakeFailure = "tls_handshake_failure"
+	ReasonTimeout             = "timeout"
+	ReasonBodyReadError       = "body_read_error"
+	ReasonUnknown             = "unknown"
+)
+
+// classifyBackendError maps an error returned by the backend transport to the
+// status code Router should respond with and a short reason describing it.
+func classifyBackendError(req *http.Request, err error) (status int, reason string) {
+	var (
+		dnsErr    *net.DNSError
+		netErr    net.Error
+		recordErr tls.RecordHeaderError
+		alertErr  tls.AlertError
+		certErr   *tls.CertificateVerificationError
+	)
+
+	switch {
+	case errors.Is(err, context.Canceled) && req.Context().Err() != nil:
+		return StatusClientClosedRequest, ReasonClientCancelled
+	case errors.As(err, &dnsErr):
+		return http.StatusBadGateway, ReasonDNSFailure
+	case errors.As(err, &netErr) && netErr.Timeout():
+		return http.StatusGatewayTimeout, ReasonTimeout
+	case errors.Is(err, syscall.ECONNREFUSED):
+		return http.StatusBadGateway, ReasonConnectionRefused
+	case errors.Is(err, syscall.ECONNRESET), errors.Is(err, io.EOF), errors.Is(err, io.ErrUnexpectedEOF):
+		return http.StatusBadGateway, ReasonConnectionReset
+	case errors.As(err, &recordErr), errors.As(err, &alertErr), errors.As(err, &certErr):
+		return http.StatusBadGateway, ReasonTLSHandshakeFailure
+	default:
+		return http.StatusInternalServerError, ReasonUnknown
+	}
+}
+
+// errorRecordingBody wraps a backend response body so that errors reading it,
+// which happen after the status line has already been sent to the client, are
+// still logged and counted.
+type errorRecordingBody struct {
+	io.ReadCloser
+	onError func(error)
+}
+
+func (b *errorRecordingBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if err != nil && !errors.Is(err, io.EOF) {
+		b.onError(err)
+		b.onError = func(error) {}
+	}
+	return n, err
+}
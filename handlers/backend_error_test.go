@@ -0,0 +1,126 @@
+package handlers
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"syscall"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/rs/zerolog"
+
+	"github.com/prometheus/client_golang/prometheus"
+	promtest "github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+type timeoutError struct{}
+
+func (timeoutError) Error() string   { return "i/o timeout" }
+func (timeoutError) Timeout() bool   { return true }
+func (timeoutError) Temporary() bool { return true }
+
+var _ = Describe("Backend error classification", func() {
+	var req *http.Request
+
+	BeforeEach(func() {
+		req = httptest.NewRequest(http.MethodGet, "/", nil)
+	})
+
+	DescribeTable("classifyBackendError",
+		func(err error, expectedStatus int, expectedReason string) {
+			status, reason := classifyBackendError(req, err)
+			Expect(status).To(Equal(expectedStatus))
+			Expect(reason).To(Equal(expectedReason))
+		},
+		Entry("connection refused",
+			&net.OpError{Op: "dial", Err: os.NewSyscallError("connect", syscall.ECONNREFUSED)},
+			http.StatusBadGateway, ReasonConnectionRefused),
+		Entry("connection reset",
+			&net.OpError{Op: "read", Err: os.NewSyscallError("read", syscall.ECONNRESET)},
+			http.StatusBadGateway, ReasonConnectionReset),
+		Entry("connection closed by backend",
+			fmt.Errorf("net/http: transport closed: %w", io.EOF),
+			http.StatusBadGateway, ReasonConnectionReset),
+		Entry("DNS failure",
+			&net.OpError{Op: "dial", Err: &net.DNSError{Err: "no such host", Name: "backend.invalid", IsNotFound: true}},
+			http.StatusBadGateway, ReasonDNSFailure),
+		Entry("TLS handshake failure",
+			&tls.CertificateVerificationError{Err: errors.New("x509: certificate signed by unknown authority")},
+			http.StatusBadGateway, ReasonTLSHandshakeFailure),
+		Entry("timeout",
+			&net.OpError{Op: "dial", Err: timeoutError{}},
+			http.StatusGatewayTimeout, ReasonTimeout),
+		Entry("anything else",
+			errors.New("something unexpected"),
+			http.StatusInternalServerError, ReasonUnknown),
+	)
+
+	It("classifies a cancelled client request as 499", func() {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		req = req.WithContext(ctx)
+
+		status, reason := classifyBackendError(req, fmt.Errorf("proxy: %w", context.Canceled))
+		Expect(status).To(Equal(StatusClientClosedRequest))
+		Expect(reason).To(Equal(ReasonClientCancelled))
+	})
+})
+
+var _ = Describe("Backend handler errors", func() {
+	var (
+		logger     = zerolog.New(os.Stdout)
+		backendURL *url.URL
+		rw         *httptest.ResponseRecorder
+	)
+
+	BeforeEach(func() {
+		// Listen then close to get an address with nothing listening on it.
+		l, err := net.Listen("tcp", "127.0.0.1:0")
+		Expect(err).NotTo(HaveOccurred())
+		backendURL, err = url.Parse("http://" + l.Addr().String())
+		Expect(err).NotTo(HaveOccurred())
+		Expect(l.Close()).To(Succeed())
+
+		rw = httptest.NewRecorder()
+	})
+
+	AfterEach(func() {
+		EnableRouterErrorHeader = false
+	})
+
+	It("returns 502 when the connection is refused", func() {
+		router := NewBackendHandler("backend-refused", backendURL, time.Second, time.Second, logger)
+		router.ServeHTTP(rw, httptest.NewRequest(http.MethodGet, backendURL.String(), nil))
+
+		Expect(rw.Result().StatusCode).To(Equal(http.StatusBadGateway))
+		Expect(rw.Result().Header.Get(RouterErrorHeader)).To(BeEmpty())
+	})
+
+	It("counts the error by reason", func() {
+		lbls := prometheus.Labels{"backend_id": "backend-refused-metric", "reason": ReasonConnectionRefused}
+		before := promtest.ToFloat64(backendErrorCountMetric.With(lbls))
+
+		router := NewBackendHandler("backend-refused-metric", backendURL, time.Second, time.Second, logger)
+		router.ServeHTTP(rw, httptest.NewRequest(http.MethodGet, backendURL.String(), nil))
+
+		Expect(promtest.ToFloat64(backendErrorCountMetric.With(lbls)) - before).To(BeNumerically("~", 1.0))
+	})
+
+	It("adds the X-Router-Error header when enabled", func() {
+		EnableRouterErrorHeader = true
+
+		router := NewBackendHandler("backend-refused", backendURL, time.Second, time.Second, logger)
+		router.ServeHTTP(rw, httptest.NewRequest(http.MethodGet, backendURL.String(), nil))
+
+		Expect(rw.Result().Header.Get(RouterErrorHeader)).To(Equal(ReasonConnectionRefused))
+	})
+})
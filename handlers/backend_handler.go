@@ -1,6 +1,7 @@
 package handlers
 
 import (
+	"bytes"
 	"crypto/tls"
 	"errors"
 	"fmt"
@@ -10,7 +11,6 @@ import (
 	"net/http/httputil"
 	"net/url"
 	"strings"
-	"syscall"
 	"time"
 
 	"github.com/prometheus/client_golang/prometheus"
@@ -28,11 +28,13 @@ func NewBackendHandler(
 
 	proxy := &httputil.ReverseProxy{}
 
-	proxy.Transport = newBackendTransport(
+	proxy.Transport = traceBackendRequests(backendID, newBackendTransport(
 		backendID,
 		connectTimeout, headerTimeout,
 		logger,
-	)
+	))
+
+	headerRules := BackendHeaderRules.ForBackend(backendID)
 
 	proxy.Rewrite = func(req *httputil.ProxyRequest) {
 		// SetURL routes the outbound request to the scheme, and base path of the backendURL. It also
@@ -41,7 +43,8 @@ func NewBackendHandler(
 		req.SetURL(backendURL)
 
 		// ReverseProxy removes X-Forwarded-* headers so to preserve the client's IP address
-		// it has to be explicitly set
+		// it has to be explicitly set. If there are trusted proxies, Router has already removed
+		// them from requests that weren't sent by one (see WithClientIP).
 		req.Out.Header["X-Forwarded-For"] = req.In.Header["X-Forwarded-For"]
 		req.SetXForwarded()
 
@@ -72,9 +75,35 @@ func NewBackendHandler(
 		}
 
 		populateViaHeader(req.Out.Header, fmt.Sprintf("%d.%d", req.Out.ProtoMajor, req.Out.ProtoMinor))
+
+		if id := RequestID(req.In.Context()); id != "" {
+			for _, header := range requestIDHeaders {
+				req.Out.Header.Set(header, id)
+			}
+		}
+
+		// Header rules for the backend and then the route are applied last, so they can override any of the above
+		applyHeaderRules(req.Out.Header, headerRules.Request)
+		applyHeaderRules(req.Out.Header, routeHeaderRules(req.In.Context()).Request)
+	}
+
+	proxy.ModifyResponse = func(resp *http.Response) error {
+		// Router has already set the request ID on the response
+		if RequestID(resp.Request.Context()) != "" {
+			resp.Header.Del(RequestIDHeader)
+		}
+		applyHeaderRules(resp.Header, headerRules.Response)
+		applyHeaderRules(resp.Header, routeHeaderRules(resp.Request.Context()).Response)
+		return nil
 	}
 
-	return proxy
+	var handler http.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		proxy.ServeHTTP(w, withIncomingRequest(r))
+	})
+	if CoalesceRequests {
+		return newCoalescingHandler(backendID, handler)
+	}
+	return handler
 }
 
 func populateViaHeader(header http.Header, httpVersion string) {
@@ -89,9 +118,14 @@ type backendTransport struct {
 	backendID string
 
 	wrapped *http.Transport
+	limiter *concurrencyLimiter
 	logger  zerolog.Logger
 }
 
+// errConcurrencyLimit is recorded for requests which weren't sent to a backend
+// because too many requests to it were in flight.
+var errConcurrencyLimit = errors.New("too many requests in flight to backend")
+
 // Construct a backendTransport that wraps an http.Transport and implements http.RoundTripper.
 // This allows us to intercept the response from the backend and modify it before it's copied
 // back to the client.
@@ -143,7 +177,12 @@ func newBackendTransport(
 		transport.TLSClientConfig = &tls.Config{InsecureSkipVerify: true}
 	}
 
-	return &backendTransport{backendID, &transport, logger}
+	return &backendTransport{
+		backendID: backendID,
+		wrapped:   &transport,
+		limiter:   newConcurrencyLimiter(backendID, BackendConcurrencyLimits.ForBackend(backendID)),
+		logger:    logger,
+	}
 }
 
 func closeBody(resp *http.Response) {
@@ -153,7 +192,28 @@ func closeBody(resp *http.Response) {
 }
 
 func (bt *backendTransport) RoundTrip(req *http.Request) (resp *http.Response, err error) {
+	if bt.limiter != nil {
+		wait, reason, ok := bt.limiter.acquire(req.Context())
+		if wait > 0 {
+			queueWaitDurationSecondsMetric.With(prometheus.Labels{"backend_id": bt.backendID}).Observe(wait.Seconds())
+		}
+		if !ok {
+			return bt.shed(req, reason), nil
+		}
+		// The request stays in flight until the response has been passed on to the
+		// client. Upgraded connections, such as WebSockets, can last for hours so
+		// they stop counting once the backend switches protocols.
+		defer func() {
+			if resp == nil || resp.Body == nil || resp.StatusCode == http.StatusSwitchingProtocols {
+				bt.limiter.release()
+				return
+			}
+			resp.Body = &releasingBody{ReadCloser: resp.Body, release: bt.limiter.release}
+		}()
+	}
+
 	var responseCode int
+	var reason string
 	var startTime = time.Now()
 
 	backendRequestCountMetric.With(prometheus.Labels{
@@ -168,37 +228,122 @@ func (bt *backendTransport) RoundTrip(req *http.Request) (resp *http.Response, e
 			"backend_id":     bt.backendID,
 			"request_method": req.Method,
 			"response_code":  fmt.Sprintf("%d", responseCode),
+			"reason":         reason,
 		}).Observe(durationSeconds)
+
+		// Backends shedding load respond quickly with errors, so 5xx responses
+		// lower an adaptive limit whatever their latency
+		if bt.limiter != nil {
+			failed := responseCode >= http.StatusInternalServerError
+			bt.limiter.observe(time.Since(startTime), failed, time.Now())
+		}
 	}()
 
 	resp, err = bt.wrapped.RoundTrip(req)
 	if err != nil {
-		var nerr net.Error
-		switch {
-		case errors.Is(err, syscall.ECONNREFUSED):
-			responseCode = http.StatusBadGateway
-		case errors.As(err, &nerr) && nerr.Timeout():
-			responseCode = http.StatusGatewayTimeout
-		default:
-			responseCode = http.StatusInternalServerError
-		}
+		responseCode, reason = classifyBackendError(req, err)
 		closeBody(resp)
-		bt.logger.Error().
-			Err(err).
-			Int("status", responseCode).
-			Str("method", req.Method).
-			Str("url", req.URL.String()).
-			Msg("backend request error")
+		bt.recordError(req, err, responseCode, reason)
 
-		return newErrorResponse(responseCode), nil
+		if responseCode == http.StatusBadGateway || responseCode == http.StatusGatewayTimeout {
+			if stale, ok := bt.staleResponseAfterError(req, reason); ok {
+				return stale, nil
+			}
+		}
+
+		return bt.newErrorResponse(req, responseCode, reason), nil
 	}
 	responseCode = resp.StatusCode
 	populateViaHeader(resp.Header, fmt.Sprintf("%d.%d", resp.ProtoMajor, resp.ProtoMinor))
+	if resp.StatusCode == http.StatusSwitchingProtocols {
+		// ReverseProxy needs the body to be writable to copy the upgraded connection
+		return
+	}
+	resp.Body = &errorRecordingBody{resp.Body, func(err error) {
+		bodyReason := ReasonBodyReadError
+		if req.Context().Err() != nil {
+			bodyReason = ReasonClientCancelled
+		}
+		bt.recordError(req, err, responseCode, bodyReason)
+	}}
+
+	if StaleResponses != nil && allowsStaleIfError(req, resp) {
+		sr := newStoredResponse(responseStoreKey(bt.backendID, req), req, resp)
+		// Stored by the path Router received, as the cache is, so that both can be purged by it
+		sr.path = incomingRequest(req).URL.Path
+		resp.Body = &capturingBody{ReadCloser: resp.Body, limit: maxStoredResponseBytes, onComplete: func(body []byte) {
+			sr.body = bytes.Clone(body)
+			StaleResponses.set(sr)
+		}}
+	}
 	return
 }
 
-func newErrorResponse(status int) (resp *http.Response) {
-	resp = &http.Response{StatusCode: status}
-	resp.Body = io.NopCloser(strings.NewReader(""))
+// shed responds to a request which wasn't allowed in flight to the backend
+// for reason, with a stale response if there is one.
+func (bt *backendTransport) shed(req *http.Request, reason string) *http.Response {
+	shedRequestCountMetric.With(prometheus.Labels{
+		"backend_id": bt.backendID,
+		"reason":     reason,
+	}).Inc()
+	recordBackendError(req, errConcurrencyLimit, reason)
+
+	if reason == ReasonClientCancelled {
+		return bt.newErrorResponse(req, StatusClientClosedRequest, reason)
+	}
+	if stale, ok := bt.staleResponseAfterError(req, reason); ok {
+		return stale
+	}
+	return bt.newErrorResponse(req, http.StatusServiceUnavailable, reason)
+}
+
+// staleResponseAfterError returns a stale response for req, which failed for
+// reason, if there is one.
+func (bt *backendTransport) staleResponseAfterError(req *http.Request, reason string) (*http.Response, bool) {
+	stale, ok := bt.staleResponse(req)
+	if !ok {
+		return nil, false
+	}
+	staleResponseCountMetric.With(prometheus.Labels{"backend_id": bt.backendID}).Inc()
+	bt.logger.Warn().
+		Str("reason", reason).
+		Str("request_id", RequestID(req.Context())).
+		Str("method", req.Method).
+		Str("url", req.URL.String()).
+		Msg("serving stale response after backend request error")
+	stale.Request = req
+	return stale, true
+}
+
+func (bt *backendTransport) recordError(req *http.Request, err error, status int, reason string) {
+	backendErrorCountMetric.With(prometheus.Labels{
+		"backend_id": bt.backendID,
+		"reason":     reason,
+	}).Inc()
+	recordBackendError(req, err, reason)
+
+	bt.logger.Error().
+		Err(err).
+		Int("status", status).
+		Str("reason", reason).
+		Str("request_id", RequestID(req.Context())).
+		Str("method", req.Method).
+		Str("url", req.URL.String()).
+		Msg("backend request error")
+}
+
+func (bt *backendTransport) newErrorResponse(req *http.Request, status int, reason string) (resp *http.Response) {
+	resp = &http.Response{StatusCode: status, Header: http.Header{}, Request: req}
+	if EnableRouterErrorHeader {
+		resp.Header.Set(RouterErrorHeader, reason)
+	}
+
+	body := ""
+	if contentType, page, ok := ErrorPages.Render(req, status, bt.backendID, reason); ok {
+		resp.Header.Set("Content-Type", contentType)
+		resp.Header.Set("X-Content-Type-Options", "nosniff")
+		body = string(page)
+	}
+	resp.Body = io.NopCloser(strings.NewReader(body))
 	return
 }
@@ -1,7 +1,10 @@
 package handlers
 
 import (
+	"bufio"
+	"fmt"
 	"io"
+	"net"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
@@ -137,6 +140,51 @@ var _ = Describe("Backend handler", func() {
 		})
 	})
 
+	Context("when the backend switches protocols", func() {
+		BeforeEach(func() {
+			router = NewBackendHandler(
+				"backend-upgrade",
+				backendURL,
+				timeout, timeout,
+				logger,
+			)
+
+			backend.AppendHandlers(func(rw http.ResponseWriter, r *http.Request) {
+				conn, brw, err := http.NewResponseController(rw).Hijack()
+				if err != nil {
+					return
+				}
+				defer conn.Close()
+				_, _ = brw.WriteString("HTTP/1.1 101 Switching Protocols\r\nConnection: Upgrade\r\nUpgrade: echo\r\n\r\n")
+				_ = brw.Flush()
+				line, _ := brw.ReadString('\n')
+				_, _ = brw.WriteString(line)
+				_ = brw.Flush()
+			})
+		})
+
+		It("should proxy the upgraded connection", func() {
+			server := httptest.NewServer(router)
+			defer server.Close()
+
+			conn, err := net.Dial("tcp", server.Listener.Addr().String())
+			Expect(err).NotTo(HaveOccurred())
+			defer conn.Close()
+			Expect(conn.SetDeadline(time.Now().Add(timeout))).To(Succeed())
+
+			_, err = fmt.Fprint(conn, "GET / HTTP/1.1\r\nHost: www.gov.uk\r\nConnection: Upgrade\r\nUpgrade: echo\r\n\r\n")
+			Expect(err).NotTo(HaveOccurred())
+			br := bufio.NewReader(conn)
+			resp, err := http.ReadResponse(br, nil)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(resp.StatusCode).To(Equal(http.StatusSwitchingProtocols))
+
+			_, err = fmt.Fprint(conn, "hello\n")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(br.ReadString('\n')).To(Equal("hello\n"))
+		})
+	})
+
 	Context("metrics", func() {
 		var (
 			beforeRequestCountMetric            float64
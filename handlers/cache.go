@@ -0,0 +1,165 @@
+package handlers
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// ResponseCache, if set, is where caching handlers store responses from
+// backends to serve to later requests while they are fresh.
+var ResponseCache *ResponseStore
+
+const (
+	cacheResultHit    = "hit"
+	cacheResultMiss   = "miss"
+	cacheResultBypass = "bypass"
+)
+
+// Statuses which are cacheable by default, from RFC 9110 section 15.1.
+var cacheableStatuses = map[int]bool{
+	http.StatusOK:                   true,
+	http.StatusNonAuthoritativeInfo: true,
+	http.StatusNoContent:            true,
+	http.StatusMultipleChoices:      true,
+	http.StatusMovedPermanently:     true,
+	http.StatusPermanentRedirect:    true,
+	http.StatusNotFound:             true,
+	http.StatusMethodNotAllowed:     true,
+	http.StatusGone:                 true,
+	http.StatusRequestURITooLong:    true,
+	http.StatusNotImplemented:       true,
+}
+
+// notModifiedHeaders are the headers sent with a 304 in place of a stored
+// response, per RFC 9110 section 15.4.5.
+var notModifiedHeaders = []string{"Age", "Cache-Control", "Content-Location", "Date", "ETag", "Expires", "Vary"}
+
+type cachingHandler struct {
+	backendID string
+	next      http.Handler
+}
+
+// NewCachingHandler returns a handler which serves responses from
+// ResponseCache while they are fresh, and otherwise passes requests to next
+// and stores the responses that allow it.
+func NewCachingHandler(backendID string, next http.Handler) http.Handler {
+	return &cachingHandler{backendID, next}
+}
+
+func (h *cachingHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if ResponseCache == nil || !cacheableRequest(r) {
+		h.countRequest(cacheResultBypass)
+		h.next.ServeHTTP(w, r)
+		return
+	}
+
+	key := h.backendID + " " + r.Host + " " + r.Header.Get("X-Forwarded-Host") + " " + r.URL.RequestURI()
+
+	if sr, ok := ResponseCache.get(key); ok && sr.matches(r) && sr.age() < responseFreshness(sr.header) {
+		h.countRequest(cacheResultHit)
+		serveFromCache(w, r, sr)
+		return
+	}
+
+	h.countRequest(cacheResultMiss)
+
+	tw := &teeResponseWriter{ResponseWriter: w, limit: maxStoredResponseBytes}
+	h.next.ServeHTTP(tw, r)
+	tw.complete = true
+
+	captured, ok := tw.captured()
+	if !ok || !cacheableResponse(captured.statusCode, captured.header) {
+		return
+	}
+
+	sr := newStoredResponse(key, r, &http.Response{StatusCode: captured.statusCode, Header: captured.header})
+	sr.path = r.URL.Path
+	sr.body = captured.body
+	ResponseCache.set(sr)
+}
+
+func (h *cachingHandler) countRequest(result string) {
+	cacheRequestCountMetric.With(prometheus.Labels{
+		"backend_id": h.backendID,
+		"result":     result,
+	}).Inc()
+}
+
+func cacheableRequest(r *http.Request) bool {
+	if r.Method != http.MethodGet || r.Header.Get("Authorization") != "" || r.Header.Get("Range") != "" {
+		return false
+	}
+
+	cc := parseCacheControl(r.Header)
+	return !cc.has("no-cache") && !cc.has("no-store")
+}
+
+func cacheableResponse(statusCode int, header http.Header) bool {
+	if !cacheableStatuses[statusCode] || header.Get("Set-Cookie") != "" || header.Get("Vary") == "*" {
+		return false
+	}
+
+	cc := parseCacheControl(header)
+	if cc.has("private") || cc.has("no-store") || cc.has("no-cache") {
+		return false
+	}
+	return responseFreshness(header) > 0
+}
+
+func serveFromCache(w http.ResponseWriter, r *http.Request, sr *storedResponse) {
+	resp := sr.response()
+	if notModified(r, resp.Header) {
+		for _, name := range notModifiedHeaders {
+			if values := resp.Header.Values(name); len(values) > 0 {
+				w.Header()[http.CanonicalHeaderKey(name)] = values
+			}
+		}
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	for name, values := range resp.Header {
+		w.Header()[name] = values
+	}
+	w.WriteHeader(resp.StatusCode)
+	_, _ = w.Write(sr.body)
+}
+
+// notModified reports whether a conditional request can be answered with a
+// 304 given the headers of the stored response.
+func notModified(r *http.Request, header http.Header) bool {
+	if inm := r.Header.Get("If-None-Match"); inm != "" {
+		return etagMatches(inm, header.Get("ETag"))
+	}
+
+	ims, err := http.ParseTime(r.Header.Get("If-Modified-Since"))
+	if err != nil {
+		return false
+	}
+	lastModified, err := http.ParseTime(header.Get("Last-Modified"))
+	if err != nil {
+		return false
+	}
+	return !lastModified.After(ims)
+}
+
+// etagMatches compares the If-None-Match header with an ETag using the weak
+// comparison function from RFC 9110 section 8.8.3.2.
+func etagMatches(ifNoneMatch, etag string) bool {
+	if etag == "" {
+		return false
+	}
+	if strings.TrimSpace(ifNoneMatch) == "*" {
+		return true
+	}
+
+	etag = strings.TrimPrefix(etag, "W/")
+	for _, candidate := range strings.Split(ifNoneMatch, ",") {
+		if strings.TrimPrefix(strings.TrimSpace(candidate), "W/") == etag {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,87 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// cacheControl holds the directives of a Cache-Control header, keyed by
+// lowercased directive name. Directives without a value map to "".
+type cacheControl map[string]string
+
+func parseCacheControl(header http.Header) cacheControl {
+	cc := cacheControl{}
+	for _, line := range header.Values("Cache-Control") {
+		for _, directive := range strings.Split(line, ",") {
+			name, value, _ := strings.Cut(strings.TrimSpace(directive), "=")
+			if name == "" {
+				continue
+			}
+			cc[strings.ToLower(name)] = strings.Trim(value, `"`)
+		}
+	}
+	return cc
+}
+
+func (cc cacheControl) has(directive string) bool {
+	_, ok := cc[directive]
+	return ok
+}
+
+// seconds returns the value of a delta-seconds directive such as max-age.
+func (cc cacheControl) seconds(directive string) (time.Duration, bool) {
+	value, ok := cc[directive]
+	if !ok {
+		return 0, false
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 0 {
+		return 0, false
+	}
+	return time.Duration(n) * time.Second, true
+}
+
+// freshnessLifetime returns how long a response may be served from a shared
+// cache without revalidation, preferring s-maxage over max-age.
+func (cc cacheControl) freshnessLifetime() time.Duration {
+	if d, ok := cc.seconds("s-maxage"); ok {
+		return d
+	}
+	d, _ := cc.seconds("max-age")
+	return d
+}
+
+// varyHeaders returns the canonicalised names of the request headers listed
+// in the Vary header of a response.
+func varyHeaders(header http.Header) []string {
+	var names []string
+	for _, line := range header.Values("Vary") {
+		for _, name := range strings.Split(line, ",") {
+			if name = strings.TrimSpace(name); name != "" {
+				names = append(names, http.CanonicalHeaderKey(name))
+			}
+		}
+	}
+	return names
+}
+
+// responseFreshness returns how long a response may be served from a shared
+// cache, from its Cache-Control header or failing that its Expires header.
+func responseFreshness(header http.Header) time.Duration {
+	cc := parseCacheControl(header)
+	if cc.has("s-maxage") || cc.has("max-age") {
+		return cc.freshnessLifetime()
+	}
+
+	expires, err := http.ParseTime(header.Get("Expires"))
+	if err != nil {
+		return 0
+	}
+	date, err := http.ParseTime(header.Get("Date"))
+	if err != nil {
+		date = time.Now()
+	}
+	return max(expires.Sub(date), 0)
+}
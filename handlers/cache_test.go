@@ -0,0 +1,147 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/prometheus/client_golang/prometheus"
+	promtest "github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+var _ = Describe("Caching handler", func() {
+	var (
+		upstreamCount int
+		status        int
+		header        http.Header
+		handler       http.Handler
+	)
+
+	serve := func(path string, headers ...string) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		for i := 0; i+1 < len(headers); i += 2 {
+			req.Header.Set(headers[i], headers[i+1])
+		}
+		handler.ServeHTTP(rr, req)
+		return rr
+	}
+
+	BeforeEach(func() {
+		upstreamCount = 0
+		status = http.StatusOK
+		header = http.Header{
+			"Cache-Control": {"public, max-age=60"},
+			"Etag":          {`"v1"`},
+			"Last-Modified": {"Mon, 02 Jan 2006 15:04:05 GMT"},
+		}
+
+		ResponseCache = NewResponseStore(1 << 20)
+		handler = NewCachingHandler("backend-cache", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			upstreamCount++
+			for k, v := range header {
+				w.Header()[k] = v
+			}
+			w.WriteHeader(status)
+			_, _ = w.Write([]byte("body"))
+		}))
+	})
+
+	AfterEach(func() {
+		ResponseCache = nil
+	})
+
+	It("serves fresh responses from the cache", func() {
+		hits := cacheRequestCountMetric.With(prometheus.Labels{"backend_id": "backend-cache", "result": "hit"})
+		before := promtest.ToFloat64(hits)
+
+		Expect(serve("/page").Body.String()).To(Equal("body"))
+		rr := serve("/page")
+
+		Expect(upstreamCount).To(Equal(1))
+		Expect(rr.Code).To(Equal(http.StatusOK))
+		Expect(rr.Body.String()).To(Equal("body"))
+		Expect(rr.Header().Get("Age")).To(Equal("0"))
+		Expect(promtest.ToFloat64(hits) - before).To(BeNumerically("~", 1.0))
+	})
+
+	It("caches each query string separately", func() {
+		serve("/page?a=1")
+		serve("/page?a=2")
+		Expect(upstreamCount).To(Equal(2))
+	})
+
+	It("caches responses with an Expires header", func() {
+		header = http.Header{"Expires": {"Mon, 01 Jan 2125 00:00:00 GMT"}}
+		serve("/page")
+		serve("/page")
+		Expect(upstreamCount).To(Equal(1))
+	})
+
+	It("does not serve stale responses", func() {
+		header.Set("Age", "120")
+		serve("/page")
+		serve("/page")
+		Expect(upstreamCount).To(Equal(2))
+	})
+
+	DescribeTable("does not cache responses which don't allow it",
+		func(headerName, value string) {
+			header.Set(headerName, value)
+			serve("/page")
+			serve("/page")
+			Expect(upstreamCount).To(Equal(2))
+		},
+		Entry("private", "Cache-Control", "private, max-age=60"),
+		Entry("no-store", "Cache-Control", "no-store"),
+		Entry("no-cache", "Cache-Control", "no-cache, max-age=60"),
+		Entry("no freshness", "Cache-Control", "public"),
+		Entry("cookies", "Set-Cookie", "session=1"),
+		Entry("vary *", "Vary", "*"),
+	)
+
+	It("does not cache error responses", func() {
+		status = http.StatusInternalServerError
+		serve("/page")
+		serve("/page")
+		Expect(upstreamCount).To(Equal(2))
+	})
+
+	It("bypasses the cache for requests with no-cache", func() {
+		serve("/page")
+		serve("/page", "Cache-Control", "no-cache")
+		Expect(upstreamCount).To(Equal(2))
+	})
+
+	It("keeps separate variants for headers listed in Vary", func() {
+		header.Set("Vary", "Accept-Language")
+		serve("/page", "Accept-Language", "cy")
+		serve("/page", "Accept-Language", "en")
+		Expect(upstreamCount).To(Equal(2))
+	})
+
+	It("answers matching If-None-Match requests with a 304", func() {
+		serve("/page")
+		rr := serve("/page", "If-None-Match", `W/"v0", "v1"`)
+
+		Expect(upstreamCount).To(Equal(1))
+		Expect(rr.Code).To(Equal(http.StatusNotModified))
+		Expect(rr.Body.String()).To(BeEmpty())
+		Expect(rr.Header().Get("ETag")).To(Equal(`"v1"`))
+		Expect(rr.Header().Get("Last-Modified")).To(BeEmpty())
+	})
+
+	It("answers If-Modified-Since requests with a 304 when not modified", func() {
+		serve("/page")
+		Expect(serve("/page", "If-Modified-Since", "Tue, 03 Jan 2006 15:04:05 GMT").Code).To(Equal(http.StatusNotModified))
+		Expect(serve("/page", "If-Modified-Since", "Sun, 01 Jan 2006 15:04:05 GMT").Code).To(Equal(http.StatusOK))
+	})
+
+	It("serves requests again after their path is purged", func() {
+		serve("/page")
+		Expect(ResponseCache.PurgePath("/page", false)).To(Equal(1))
+		serve("/page")
+		Expect(upstreamCount).To(Equal(2))
+	})
+})
@@ -0,0 +1,163 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const canonicalRedirectHandlerType = "canonical-redirect-handler"
+
+// CanonicalRules configures the redirects that Router makes before looking up
+// a route, so that each page is served from a single canonical URL.
+type CanonicalRules struct {
+	// Hosts maps hostnames to the canonical hostname that requests for them
+	// are redirected to, for example "gov.uk" to "www.gov.uk".
+	Hosts map[string]string `json:"hosts"`
+	// ForceHTTPS redirects requests which X-Forwarded-Proto says were made
+	// over plain HTTP to HTTPS.
+	ForceHTTPS bool `json:"force_https"`
+	// RedirectCode is the HTTP status code of canonicalisation redirects,
+	// which defaults to 301.
+	RedirectCode int `json:"redirect_code"`
+	// PathNormalisation sets what to do with requests whose path isn't in
+	// its canonical form.
+	PathNormalisation PathNormalisation `json:"path_normalisation"`
+	// Case sets which paths are redirected to their lowercase form.
+	Case CasePolicy `json:"case"`
+}
+
+// Canonical holds the canonicalisation rules, or nil if there are none.
+var Canonical *CanonicalRules
+
+// LoadCanonicalRules reads canonicalisation rules from a JSON file.
+func LoadCanonicalRules(path string) (*CanonicalRules, error) {
+	data, err := os.ReadFile(path) //nolint:gosec // path is from ROUTER_CANONICAL_RULES_FILE env var, controlled by user
+	if err != nil {
+		return nil, fmt.Errorf("failed to read canonicalisation rules: %w", err)
+	}
+
+	rules := &CanonicalRules{}
+	if err := json.Unmarshal(data, rules); err != nil {
+		return nil, fmt.Errorf("failed to parse canonicalisation rules: %w", err)
+	}
+
+	if rules.RedirectCode == 0 {
+		rules.RedirectCode = http.StatusMovedPermanently
+	}
+	if !IsRedirectCode(rules.RedirectCode) {
+		return nil, fmt.Errorf("invalid canonicalisation redirect_code %d", rules.RedirectCode)
+	}
+
+	if err := rules.PathNormalisation.validate(); err != nil {
+		return nil, err
+	}
+	if err := rules.Case.validate(); err != nil {
+		return nil, err
+	}
+
+	hosts := make(map[string]string, len(rules.Hosts))
+	for host, canonicalHost := range rules.Hosts {
+		if canonicalHost == "" {
+			return nil, fmt.Errorf("empty canonical host for %q", host)
+		}
+		hosts[strings.ToLower(host)] = canonicalHost
+	}
+	rules.Hosts = hosts
+
+	return rules, nil
+}
+
+// canonicalise works out whether r was made to its canonical URL. It returns
+// PathPolicyRoute if so, PathPolicyRedirect and the absolute URL to redirect
+// to if not, or PathPolicyReject if r should be rejected.
+func (rules *CanonicalRules) canonicalise(r *http.Request) (string, string) {
+	path, action := rules.PathNormalisation.normalise(r.URL.EscapedPath(), true)
+	if action == PathPolicyReject {
+		return action, ""
+	}
+
+	scheme := requestScheme(r)
+	if rules.ForceHTTPS && scheme == "http" && r.Header.Get("X-Forwarded-Proto") != "" {
+		scheme = "https"
+		action = PathPolicyRedirect
+	}
+
+	host := r.Host
+	hostname := host
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		hostname = h
+	}
+	if canonicalHost, ok := rules.Hosts[strings.ToLower(hostname)]; ok {
+		host = canonicalHost
+		action = PathPolicyRedirect
+	}
+
+	if action != PathPolicyRedirect {
+		return action, ""
+	}
+	if path == "" {
+		path = "/"
+	}
+	location := scheme + "://" + host + path
+	if r.URL.RawQuery != "" {
+		location += "?" + r.URL.RawQuery
+	}
+	return action, location
+}
+
+// CanonicalPath returns the escaped path that requests for the escaped path
+// are redirected to under the path normalisation rules in Canonical, which is
+// path itself if it's canonical, or false if they're rejected.
+func CanonicalPath(path string) (string, bool) {
+	if Canonical == nil {
+		return path, true
+	}
+	path, action := Canonical.PathNormalisation.normalise(path, false)
+	return path, action != PathPolicyReject
+}
+
+// requestScheme returns the scheme that the client used to make r, according
+// to X-Forwarded-Proto if it was set by a proxy in front of Router.
+func requestScheme(r *http.Request) string {
+	if proto := r.Header.Get("X-Forwarded-Proto"); proto != "" {
+		proto, _, _ = strings.Cut(proto, ",")
+		return strings.ToLower(strings.TrimSpace(proto))
+	}
+	if r.TLS != nil {
+		return "https"
+	}
+	return "http"
+}
+
+// ServeCanonicalRedirect redirects r to its canonical URL, or rejects it if
+// its path can't be used, according to the rules in Canonical. It reports
+// whether it responded to r.
+func ServeCanonicalRedirect(w http.ResponseWriter, r *http.Request) bool {
+	if Canonical == nil {
+		return false
+	}
+
+	switch action, location := Canonical.canonicalise(r); action {
+	case PathPolicyReject:
+		if !ServeErrorPage(w, r, http.StatusBadRequest) {
+			http.Error(w, "400 Bad Request", http.StatusBadRequest)
+		}
+		return true
+	case PathPolicyRedirect:
+		addCacheHeaders(w, RedirectCacheDuration)
+		http.Redirect(w, r, location, Canonical.RedirectCode)
+
+		redirectCountMetric.With(prometheus.Labels{
+			"redirect_type": canonicalRedirectHandlerType,
+		}).Inc()
+		return true
+	default:
+		return false
+	}
+}
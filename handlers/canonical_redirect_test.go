@@ -0,0 +1,119 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Canonical redirects", func() {
+	var rr *httptest.ResponseRecorder
+
+	loadRules := func(content string) (*CanonicalRules, error) {
+		path := filepath.Join(GinkgoT().TempDir(), "canonical.json")
+		Expect(os.WriteFile(path, []byte(content), 0o600)).To(Succeed())
+		return LoadCanonicalRules(path)
+	}
+
+	newRequest := func(url, forwardedProto string) *http.Request {
+		req := httptest.NewRequest(http.MethodGet, url, nil)
+		if forwardedProto != "" {
+			req.Header.Set("X-Forwarded-Proto", forwardedProto)
+		}
+		return req
+	}
+
+	BeforeEach(func() {
+		rr = httptest.NewRecorder()
+
+		rules, err := loadRules(`{"hosts": {"GOV.UK": "www.gov.uk", "old.example.com": "www.gov.uk"}, "force_https": true}`)
+		Expect(err).NotTo(HaveOccurred())
+		Canonical = rules
+	})
+
+	AfterEach(func() {
+		Canonical = nil
+	})
+
+	It("defaults to 301 redirects", func() {
+		Expect(Canonical.RedirectCode).To(Equal(http.StatusMovedPermanently))
+	})
+
+	It("fails to load rules with an invalid redirect code", func() {
+		_, err := loadRules(`{"redirect_code": 200}`)
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("fails to load rules with an invalid case mode", func() {
+		_, err := loadRules(`{"case": {"mode": "upper"}}`)
+		Expect(err).To(MatchError(ContainSubstring("case mode")))
+	})
+
+	It("loads the case policy", func() {
+		rules, err := loadRules(`{"case": {"mode": "mixed", "exempt_prefixes": ["/uploads"]}}`)
+		Expect(err).NotTo(HaveOccurred())
+		Canonical = rules
+		Expect(CaseRules()).To(Equal(CasePolicy{Mode: CaseModeMixed, ExemptPrefixes: []string{"/uploads"}}))
+	})
+
+	It("defaults to redirecting uppercase paths", func() {
+		Expect(CaseRules().Mode).To(Equal(CaseModeUppercase))
+		Canonical = nil
+		Expect(CaseRules().Mode).To(Equal(CaseModeUppercase))
+	})
+
+	DescribeTable("exempts paths from case redirects",
+		func(path string, expected bool) {
+			policy := CasePolicy{ExemptPrefixes: []string{"/uploads/", "/api/Content"}}
+			Expect(policy.Exempt(path)).To(Equal(expected))
+		},
+		Entry("prefix", "/uploads", true),
+		Entry("under prefix", "/uploads/File.PDF", true),
+		Entry("under prefix in another case", "/UPLOADS/FILE.PDF", true),
+		Entry("mixed case prefix", "/api/content/Foo", true),
+		Entry("partial segment", "/uploadsfoo", false),
+		Entry("other path", "/Government", false),
+	)
+
+	It("fails to load rules which aren't valid JSON", func() {
+		_, err := loadRules(`{"hosts": `)
+		Expect(err).To(HaveOccurred())
+	})
+
+	DescribeTable("redirects to the canonical URL",
+		func(url, forwardedProto, expectedLocation string) {
+			Expect(ServeCanonicalRedirect(rr, newRequest(url, forwardedProto))).To(BeTrue())
+			Expect(rr.Code).To(Equal(http.StatusMovedPermanently))
+			Expect(rr.Header().Get("Location")).To(Equal(expectedLocation))
+			Expect(rr.Header().Get("Cache-Control")).To(Equal("max-age=1800, public"))
+		},
+		Entry("non-canonical host", "http://gov.uk/foo?bar=baz", "https", "https://www.gov.uk/foo?bar=baz"),
+		Entry("non-canonical host with port", "http://old.example.com:8080/foo", "", "http://www.gov.uk/foo"),
+		Entry("plain HTTP", "http://www.gov.uk/foo%20bar", "http", "https://www.gov.uk/foo%20bar"),
+		Entry("plain HTTP to a non-canonical host", "http://gov.uk/", "http", "https://www.gov.uk/"),
+	)
+
+	DescribeTable("doesn't redirect canonical URLs",
+		func(url, forwardedProto string) {
+			Expect(ServeCanonicalRedirect(rr, newRequest(url, forwardedProto))).To(BeFalse())
+			Expect(rr.Header().Get("Location")).To(BeEmpty())
+		},
+		Entry("HTTPS", "http://www.gov.uk/foo", "https"),
+		Entry("no X-Forwarded-Proto", "http://www.gov.uk/foo", ""),
+		Entry("other host", "http://www.example.com/foo", "https"),
+	)
+
+	It("doesn't enforce HTTPS unless configured to", func() {
+		Canonical.ForceHTTPS = false
+		Expect(ServeCanonicalRedirect(rr, newRequest("http://www.gov.uk/foo", "http"))).To(BeFalse())
+	})
+
+	It("doesn't redirect when there are no rules", func() {
+		Canonical = nil
+		Expect(ServeCanonicalRedirect(rr, newRequest("http://gov.uk/foo", "http"))).To(BeFalse())
+	})
+})
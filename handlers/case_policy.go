@@ -0,0 +1,65 @@
+package handlers
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Case modes say which paths are redirected to their lowercase form.
+const (
+	// CaseModeUppercase redirects paths which are entirely uppercase, such
+	// as /GOVERNMENT/GUIDANCE. This is the default.
+	CaseModeUppercase = "uppercase"
+	// CaseModeMixed also redirects paths with any uppercase letters, such as
+	// /Government/Publications, when the lowercase path has a route and the
+	// original path doesn't.
+	CaseModeMixed = "mixed"
+	// CaseModeOff doesn't redirect any paths to lowercase.
+	CaseModeOff = "off"
+)
+
+// CasePolicy configures redirects from paths containing uppercase letters to
+// their lowercase form.
+type CasePolicy struct {
+	Mode string `json:"mode"`
+	// ExemptPrefixes are path prefixes under which case matters, so paths
+	// are never redirected to lowercase.
+	ExemptPrefixes []string `json:"exempt_prefixes"`
+}
+
+func (p *CasePolicy) validate() error {
+	switch p.Mode {
+	case "", CaseModeUppercase, CaseModeMixed, CaseModeOff:
+		return nil
+	default:
+		return fmt.Errorf("invalid case mode %q", p.Mode)
+	}
+}
+
+// Exempt reports whether path is under one of the exempt prefixes. Prefixes
+// match whole path segments, ignoring case.
+func (p *CasePolicy) Exempt(path string) bool {
+	for _, prefix := range p.ExemptPrefixes {
+		prefix = strings.TrimSuffix(prefix, "/")
+		if len(path) < len(prefix) || !strings.EqualFold(path[:len(prefix)], prefix) {
+			continue
+		}
+		if len(path) == len(prefix) || path[len(prefix)] == '/' {
+			return true
+		}
+	}
+	return false
+}
+
+// CaseRules returns the case policy from Canonical, or the default policy if
+// there are no canonicalisation rules.
+func CaseRules() CasePolicy {
+	if Canonical == nil {
+		return CasePolicy{Mode: CaseModeUppercase}
+	}
+	policy := Canonical.Case
+	if policy.Mode == "" {
+		policy.Mode = CaseModeUppercase
+	}
+	return policy
+}
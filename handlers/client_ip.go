@@ -0,0 +1,136 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+)
+
+// TrustedProxies are the networks of the proxies in front of Router, such as
+// load balancers, whose forwarding headers are trusted. If it's empty, no
+// forwarding headers are trusted, but they're passed on to backends unchanged.
+var TrustedProxies []netip.Prefix
+
+// forwardingHeaders are set by proxies to describe the requests they forward,
+// so they're removed from requests sent by untrusted peers.
+var forwardingHeaders = []string{
+	"Forwarded",
+	"X-Forwarded-For",
+	"X-Forwarded-Host",
+	"X-Forwarded-Port",
+	"X-Forwarded-Proto",
+	"X-Real-Ip",
+}
+
+// ParseTrustedProxies parses a comma-separated list of CIDR ranges and IP
+// addresses.
+func ParseTrustedProxies(s string) ([]netip.Prefix, error) {
+	var proxies []netip.Prefix
+	for _, proxy := range strings.Split(s, ",") {
+		proxy = strings.TrimSpace(proxy)
+		if proxy == "" {
+			continue
+		}
+		if !strings.Contains(proxy, "/") {
+			addr, err := netip.ParseAddr(proxy)
+			if err != nil {
+				return nil, fmt.Errorf("invalid trusted proxy %q: %w", proxy, err)
+			}
+			addr = addr.Unmap()
+			proxies = append(proxies, netip.PrefixFrom(addr, addr.BitLen()))
+			continue
+		}
+		prefix, err := netip.ParsePrefix(proxy)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trusted proxy %q: %w", proxy, err)
+		}
+		proxies = append(proxies, prefix.Masked())
+	}
+	return proxies, nil
+}
+
+type clientIPKey struct{}
+
+// WithClientIP returns r with the IP address of the client that made it in
+// its context. If the peer that sent r is a trusted proxy, the client is the
+// last address in X-Forwarded-For that isn't a trusted proxy. Otherwise the
+// peer is the client, and if there are trusted proxies the forwarding headers
+// it sent are removed from r, as it could have set them to anything.
+func WithClientIP(r *http.Request) *http.Request {
+	peer := peerIP(r)
+	if len(TrustedProxies) == 0 {
+		return r.WithContext(context.WithValue(r.Context(), clientIPKey{}, peer))
+	}
+	if trustedProxy(peer) {
+		return r.WithContext(context.WithValue(r.Context(), clientIPKey{}, forwardedClientIP(r.Header, peer)))
+	}
+
+	r = r.Clone(context.WithValue(r.Context(), clientIPKey{}, peer))
+	for _, name := range forwardingHeaders {
+		r.Header.Del(name)
+	}
+	return r
+}
+
+// ClientIP returns the IP address of the client that made r, or of the peer
+// that sent r if WithClientIP hasn't been used. The address isn't valid if the
+// peer's isn't known.
+func ClientIP(r *http.Request) netip.Addr {
+	if client, ok := r.Context().Value(clientIPKey{}).(netip.Addr); ok {
+		return client
+	}
+	return peerIP(r)
+}
+
+// trustedPeer reports whether the peer that sent r is a trusted proxy, or
+// could be one because there are no trusted proxies configured.
+func trustedPeer(r *http.Request) bool {
+	return len(TrustedProxies) == 0 || trustedProxy(peerIP(r))
+}
+
+func trustedProxy(ip netip.Addr) bool {
+	for _, proxy := range TrustedProxies {
+		if proxy.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// forwardedClientIP walks back through X-Forwarded-For from peer, returning
+// the first address that isn't a trusted proxy, or the earliest valid one if
+// they all are.
+func forwardedClientIP(header http.Header, peer netip.Addr) netip.Addr {
+	var hops []string
+	for _, value := range header.Values("X-Forwarded-For") {
+		hops = append(hops, strings.Split(value, ",")...)
+	}
+
+	client := peer
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop, err := netip.ParseAddr(strings.TrimSpace(hops[i]))
+		if err != nil {
+			break
+		}
+		client = hop.Unmap()
+		if !trustedProxy(client) {
+			break
+		}
+	}
+	return client
+}
+
+func peerIP(r *http.Request) netip.Addr {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	ip, err := netip.ParseAddr(host)
+	if err != nil {
+		return netip.Addr{}
+	}
+	return ip.Unmap()
+}
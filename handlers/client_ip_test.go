@@ -0,0 +1,107 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"net/url"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/onsi/gomega/ghttp"
+	"github.com/rs/zerolog"
+)
+
+var _ = Describe("Client IP addresses", func() {
+	var req *http.Request
+
+	BeforeEach(func() {
+		req = httptest.NewRequest(http.MethodGet, "/foo", nil)
+		req.RemoteAddr = "10.0.0.5:1234"
+		req.Header.Set("X-Forwarded-For", "203.0.113.9, 198.51.100.7, 10.0.0.4")
+		req.Header.Set("X-Forwarded-Proto", "https")
+		req.Header.Set("X-Forwarded-Host", "www.gov.uk")
+	})
+
+	AfterEach(func() {
+		TrustedProxies = nil
+		TrustRequestID = false
+	})
+
+	trust := func(proxies string) {
+		var err error
+		TrustedProxies, err = ParseTrustedProxies(proxies)
+		Expect(err).NotTo(HaveOccurred())
+	}
+
+	It("uses the peer's address but keeps forwarding headers when there are no trusted proxies", func() {
+		req = WithClientIP(req)
+		Expect(ClientIP(req)).To(Equal(netip.MustParseAddr("10.0.0.5")))
+		Expect(req.Header.Get("X-Forwarded-For")).To(Equal("203.0.113.9, 198.51.100.7, 10.0.0.4"))
+		Expect(req.Header.Get("X-Forwarded-Proto")).To(Equal("https"))
+	})
+
+	It("uses the last address in X-Forwarded-For that isn't a trusted proxy", func() {
+		trust("10.0.0.0/8")
+		req = WithClientIP(req)
+		Expect(ClientIP(req)).To(Equal(netip.MustParseAddr("198.51.100.7")))
+		Expect(req.Header.Get("X-Forwarded-For")).To(Equal("203.0.113.9, 198.51.100.7, 10.0.0.4"))
+		Expect(req.Header.Get("X-Forwarded-Host")).To(Equal("www.gov.uk"))
+	})
+
+	It("stops at an invalid address in X-Forwarded-For", func() {
+		trust("10.0.0.0/8")
+		req.Header.Set("X-Forwarded-For", "203.0.113.9, unknown, 10.0.0.4")
+		Expect(ClientIP(WithClientIP(req))).To(Equal(netip.MustParseAddr("10.0.0.4")))
+	})
+
+	It("removes forwarding headers from untrusted peers", func() {
+		trust("192.0.2.10, 10.1.0.0/16")
+		original := req
+		req = WithClientIP(req)
+		Expect(ClientIP(req)).To(Equal(netip.MustParseAddr("10.0.0.5")))
+		for _, header := range forwardingHeaders {
+			Expect(req.Header.Values(header)).To(BeEmpty())
+		}
+		Expect(original.Header.Get("X-Forwarded-For")).NotTo(BeEmpty())
+	})
+
+	It("only uses request IDs from trusted proxies", func() {
+		trust("192.0.2.10")
+		TrustRequestID = true
+		req.Header.Set(RequestIDHeader, "client-id")
+		Expect(RequestID(WithRequestID(httptest.NewRecorder(), req).Context())).NotTo(Equal("client-id"))
+
+		req.RemoteAddr = "192.0.2.10:1234"
+		Expect(RequestID(WithRequestID(httptest.NewRecorder(), req).Context())).To(Equal("client-id"))
+	})
+
+	It("only passes the peer's address to backends from untrusted peers", func() {
+		backend := ghttp.NewServer()
+		defer backend.Close()
+		backend.AppendHandlers(ghttp.CombineHandlers(
+			ghttp.VerifyHeaderKV("X-Forwarded-For", "10.0.0.5"),
+			func(_ http.ResponseWriter, r *http.Request) {
+				Expect(r.Header.Values("X-Forwarded-Proto")).To(BeEmpty())
+				Expect(r.Header.Values("X-Forwarded-Host")).To(BeEmpty())
+			},
+		))
+		backendURL, err := url.Parse(backend.URL())
+		Expect(err).NotTo(HaveOccurred())
+
+		trust("192.0.2.10")
+		rr := httptest.NewRecorder()
+		NewBackendHandler("backend", backendURL, time.Second, time.Second, zerolog.Nop()).ServeHTTP(rr, WithClientIP(req))
+		Expect(rr.Code).To(Equal(http.StatusOK))
+	})
+
+	DescribeTable("rejects invalid trusted proxies",
+		func(proxies string) {
+			_, err := ParseTrustedProxies(proxies)
+			Expect(err).To(HaveOccurred())
+		},
+		Entry("invalid address", "10.0.0"),
+		Entry("invalid prefix length", "10.0.0.0/33"),
+	)
+})
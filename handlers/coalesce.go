@@ -0,0 +1,321 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// CoalesceRequests controls whether backend handlers collapse identical
+// concurrent GET requests into a single request to the backend.
+var CoalesceRequests bool
+
+// coalesceKeyHeaders are the request headers which must match for two
+// requests to share a response, in addition to any listed in the Vary
+// header of the response itself.
+var coalesceKeyHeaders = []string{"Accept", "Accept-Encoding", "Accept-Language", "Cookie", "X-Forwarded-Host"}
+
+// coalescingHandler passes the first of a set of identical concurrent GET
+// requests (the leader) to the backend, and replays its response to the rest
+// (the followers) rather than sending them to the backend as well. The
+// leader's response is read from the backend in full before it's sent to any
+// client, so that followers don't wait for the leader's client to download it.
+type coalescingHandler struct {
+	backendID string
+	next      http.Handler
+
+	mu       sync.Mutex
+	inflight map[string]*coalescedCall
+}
+
+type coalescedCall struct {
+	done chan struct{}
+	req  *http.Request
+	// resp is nil if the leader's response can't be shared.
+	resp *storedResponse
+
+	// ctx is the context of the request to the backend, which is only
+	// cancelled once the leader and all the followers have gone.
+	ctx     context.Context
+	cancel  context.CancelFunc
+	waiting int
+}
+
+func newCoalescingHandler(backendID string, next http.Handler) *coalescingHandler {
+	return &coalescingHandler{
+		backendID: backendID,
+		next:      next,
+		inflight:  make(map[string]*coalescedCall),
+	}
+}
+
+func coalesceKey(r *http.Request) (string, bool) {
+	if r.Method != http.MethodGet || r.Header.Get("Authorization") != "" || r.Header.Get("Range") != "" || r.Header.Get("Upgrade") != "" {
+		return "", false
+	}
+	if r.Body != nil && r.Body != http.NoBody {
+		return "", false
+	}
+
+	var key strings.Builder
+	key.WriteString(r.Host + " " + r.URL.RequestURI())
+	for _, name := range coalesceKeyHeaders {
+		key.WriteString("\n" + name + ": " + strings.Join(r.Header.Values(name), ", "))
+	}
+	return key.String(), true
+}
+
+func (h *coalescingHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	key, ok := coalesceKey(r)
+	if !ok {
+		h.next.ServeHTTP(w, r)
+		return
+	}
+
+	h.mu.Lock()
+	call, following := h.inflight[key]
+	if !following {
+		ctx, cancel := context.WithCancel(context.WithoutCancel(r.Context()))
+		call = &coalescedCall{done: make(chan struct{}), req: r, ctx: ctx, cancel: cancel}
+		h.inflight[key] = call
+	}
+	call.waiting++
+	h.mu.Unlock()
+
+	stop := context.AfterFunc(r.Context(), func() { h.leave(call) })
+	defer stop()
+
+	if following {
+		h.follow(w, r, call)
+		return
+	}
+	h.lead(w, r, key, call)
+}
+
+// leave records that the client of the leader or a follower has gone, and
+// cancels the request to the backend if nobody is waiting for it any more.
+func (h *coalescingHandler) leave(call *coalescedCall) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	call.waiting--
+	if call.waiting == 0 {
+		call.cancel()
+	}
+}
+
+func (h *coalescingHandler) lead(w http.ResponseWriter, r *http.Request, key string, call *coalescedCall) {
+	defer call.cancel()
+
+	bw := &bufferedResponseWriter{ResponseWriter: w, limit: maxStoredResponseBytes}
+	bw.release = func(sr *storedResponse) {
+		h.mu.Lock()
+		delete(h.inflight, key)
+		h.mu.Unlock()
+
+		call.resp = sr
+		close(call.done)
+	}
+	// Followers make their own requests if the leader's fails part way
+	defer bw.releaseFollowers(nil)
+
+	h.next.ServeHTTP(bw, r.WithContext(call.ctx))
+	bw.finish()
+}
+
+func (h *coalescingHandler) follow(w http.ResponseWriter, r *http.Request, call *coalescedCall) {
+	select {
+	case <-call.done:
+	case <-r.Context().Done():
+		return
+	}
+
+	if call.resp == nil || !sameVariant(call.resp.header, call.req, r) {
+		h.next.ServeHTTP(w, r)
+		return
+	}
+
+	coalescedRequestCountMetric.With(prometheus.Labels{"backend_id": h.backendID}).Inc()
+	call.resp.writeTo(w)
+}
+
+// bufferedResponseWriter holds back a response, up to limit bytes of body,
+// until it has been written in full, so that followers can be released
+// before it's sent to the client. Responses which are larger, stream events
+// or have trailers are written straight through to the client instead, and
+// followers are released without them.
+type bufferedResponseWriter struct {
+	http.ResponseWriter
+	statusCode int
+	header     http.Header
+	body       bytes.Buffer
+	limit      int
+	streaming  bool
+
+	release  func(*storedResponse)
+	released bool
+}
+
+func (bw *bufferedResponseWriter) WriteHeader(statusCode int) {
+	// Informational responses such as 103 Early Hints are passed on straight away
+	if bw.streaming || statusCode < http.StatusOK {
+		bw.ResponseWriter.WriteHeader(statusCode)
+		return
+	}
+	if bw.header != nil {
+		return
+	}
+
+	bw.statusCode = statusCode
+	bw.header = bw.ResponseWriter.Header().Clone()
+	// The request ID belongs to this request, so it isn't shared
+	bw.header.Del(RequestIDHeader)
+
+	if strings.HasPrefix(bw.header.Get("Content-Type"), "text/event-stream") || bw.header.Get("Trailer") != "" {
+		bw.stream()
+	}
+}
+
+func (bw *bufferedResponseWriter) Write(p []byte) (int, error) {
+	if bw.header == nil {
+		bw.WriteHeader(http.StatusOK)
+	}
+	if !bw.streaming && bw.body.Len()+len(p) > bw.limit {
+		bw.stream()
+	}
+	if bw.streaming {
+		return bw.ResponseWriter.Write(p)
+	}
+	return bw.body.Write(p)
+}
+
+// Flush only has an effect once the response is being streamed, as there is
+// nothing to send to the client before that.
+func (bw *bufferedResponseWriter) Flush() {
+	if !bw.streaming {
+		return
+	}
+	if f, ok := bw.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (bw *bufferedResponseWriter) Unwrap() http.ResponseWriter {
+	return bw.ResponseWriter
+}
+
+// stream releases followers without the response, and writes what has been
+// held back of it to the client.
+func (bw *bufferedResponseWriter) stream() {
+	bw.streaming = true
+	bw.releaseFollowers(nil)
+
+	bw.ResponseWriter.WriteHeader(bw.statusCode)
+	if bw.body.Len() > 0 {
+		_, _ = bw.ResponseWriter.Write(bw.body.Bytes())
+		bw.body = bytes.Buffer{}
+	}
+}
+
+// finish releases followers with the response, if the cache would store it,
+// and then writes it to the client.
+func (bw *bufferedResponseWriter) finish() {
+	if bw.streaming {
+		return
+	}
+	if bw.header == nil {
+		bw.WriteHeader(http.StatusOK)
+	}
+
+	if cacheableResponse(bw.statusCode, bw.header) {
+		bw.releaseFollowers(&storedResponse{statusCode: bw.statusCode, header: bw.header, body: bw.body.Bytes()})
+	} else {
+		bw.releaseFollowers(nil)
+	}
+
+	bw.ResponseWriter.WriteHeader(bw.statusCode)
+	_, _ = bw.ResponseWriter.Write(bw.body.Bytes())
+}
+
+func (bw *bufferedResponseWriter) releaseFollowers(sr *storedResponse) {
+	if !bw.released {
+		bw.released = true
+		bw.release(sr)
+	}
+}
+
+// sameVariant reports whether a response to leader can be used for follower,
+// given the request headers listed in the response's Vary header.
+func sameVariant(header http.Header, leader, follower *http.Request) bool {
+	for _, name := range varyHeaders(header) {
+		if name == "*" || leader.Header.Get(name) != follower.Header.Get(name) {
+			return false
+		}
+	}
+	return true
+}
+
+// teeResponseWriter writes a response through to the client while keeping a
+// copy of it, up to limit bytes of body, to store in the cache.
+type teeResponseWriter struct {
+	http.ResponseWriter
+	statusCode int
+	header     http.Header
+	body       bytes.Buffer
+	limit      int
+	overflow   bool
+	complete   bool
+}
+
+func (tw *teeResponseWriter) WriteHeader(statusCode int) {
+	// Informational responses such as 103 Early Hints are passed on but not kept.
+	if tw.header == nil && statusCode >= http.StatusOK {
+		tw.statusCode = statusCode
+		tw.header = tw.ResponseWriter.Header().Clone()
+		// The request ID belongs to this request, so it isn't shared or cached
+		tw.header.Del(RequestIDHeader)
+	}
+	tw.ResponseWriter.WriteHeader(statusCode)
+}
+
+func (tw *teeResponseWriter) Write(p []byte) (int, error) {
+	if tw.header == nil {
+		tw.WriteHeader(http.StatusOK)
+	}
+	if !tw.overflow {
+		if tw.body.Len()+len(p) > tw.limit {
+			tw.overflow = true
+			tw.body = bytes.Buffer{}
+		} else {
+			tw.body.Write(p)
+		}
+	}
+	return tw.ResponseWriter.Write(p)
+}
+
+func (tw *teeResponseWriter) Flush() {
+	if f, ok := tw.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (tw *teeResponseWriter) Unwrap() http.ResponseWriter {
+	return tw.ResponseWriter
+}
+
+// captured returns the copy of the response, if it was written in full.
+func (tw *teeResponseWriter) captured() (*storedResponse, bool) {
+	if !tw.complete || tw.overflow || tw.header == nil {
+		return nil, false
+	}
+
+	return &storedResponse{
+		statusCode: tw.statusCode,
+		header:     tw.header,
+		body:       tw.body.Bytes(),
+	}, true
+}
@@ -0,0 +1,214 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/prometheus/client_golang/prometheus"
+	promtest "github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+var _ = Describe("Request coalescing", func() {
+	var (
+		upstreamCount     atomic.Int32
+		upstreamCancelled atomic.Bool
+		release           chan struct{}
+		header            http.Header
+		status            int
+		handler           http.Handler
+	)
+
+	BeforeEach(func() {
+		upstreamCount.Store(0)
+		upstreamCancelled.Store(false)
+		release = make(chan struct{})
+		header = http.Header{"Cache-Control": {"public, max-age=60"}}
+		status = http.StatusOK
+
+		handler = newCoalescingHandler("backend-coalesce", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			upstreamCount.Add(1)
+			select {
+			case <-release:
+			case <-r.Context().Done():
+				upstreamCancelled.Store(true)
+				return
+			}
+			for k, v := range header {
+				w.Header()[k] = v
+			}
+			w.WriteHeader(status)
+			_, _ = w.Write([]byte("shared body"))
+		}))
+	})
+
+	// serveConcurrently sends the requests through the handler at the same
+	// time, releasing the upstream once they have all arrived.
+	serveConcurrently := func(reqs ...*http.Request) []*httptest.ResponseRecorder {
+		recorders := make([]*httptest.ResponseRecorder, len(reqs))
+		var wg sync.WaitGroup
+		for i, req := range reqs {
+			recorders[i] = httptest.NewRecorder()
+			wg.Go(func() {
+				handler.ServeHTTP(recorders[i], req)
+			})
+		}
+
+		Eventually(upstreamCount.Load).Should(BeNumerically(">=", 1))
+		time.Sleep(50 * time.Millisecond)
+		close(release)
+		wg.Wait()
+		return recorders
+	}
+
+	newGet := func(headers ...string) *http.Request {
+		req := httptest.NewRequest(http.MethodGet, "/page?q=1", nil)
+		for i := 0; i+1 < len(headers); i += 2 {
+			req.Header.Set(headers[i], headers[i+1])
+		}
+		return req
+	}
+
+	It("sends one request upstream for identical concurrent requests", func() {
+		lbls := prometheus.Labels{"backend_id": "backend-coalesce"}
+		before := promtest.ToFloat64(coalescedRequestCountMetric.With(lbls))
+
+		recorders := serveConcurrently(newGet(), newGet(), newGet())
+
+		Expect(upstreamCount.Load()).To(BeEquivalentTo(1))
+		for _, rr := range recorders {
+			Expect(rr.Code).To(Equal(http.StatusOK))
+			Expect(rr.Body.String()).To(Equal("shared body"))
+			Expect(rr.Header().Get("Cache-Control")).To(Equal("public, max-age=60"))
+		}
+		Expect(promtest.ToFloat64(coalescedRequestCountMetric.With(lbls)) - before).To(BeNumerically("~", 2.0))
+	})
+
+	// serveInBackground serves req with the handler in a goroutine, returning a
+	// channel which is closed once it has been served.
+	serveInBackground := func(w http.ResponseWriter, req *http.Request) chan struct{} {
+		done := make(chan struct{})
+		go func() {
+			defer GinkgoRecover()
+			defer close(done)
+			handler.ServeHTTP(w, req)
+		}()
+		return done
+	}
+
+	It("releases followers before the leader's client has read the response", func() {
+		leader := &blockingRecorder{ResponseRecorder: httptest.NewRecorder(), unblock: make(chan struct{})}
+		leaderDone := serveInBackground(leader, newGet())
+		Eventually(upstreamCount.Load).Should(BeEquivalentTo(1))
+
+		follower := httptest.NewRecorder()
+		followerDone := serveInBackground(follower, newGet())
+		time.Sleep(50 * time.Millisecond)
+		close(release)
+
+		Eventually(followerDone).Should(BeClosed())
+		Expect(follower.Body.String()).To(Equal("shared body"))
+		Expect(leaderDone).NotTo(BeClosed())
+
+		close(leader.unblock)
+		Eventually(leaderDone).Should(BeClosed())
+		Expect(leader.Body.String()).To(Equal("shared body"))
+		Expect(upstreamCount.Load()).To(BeEquivalentTo(1))
+	})
+
+	It("shares the response with followers after the leader's client has gone", func() {
+		ctx, cancel := context.WithCancel(context.Background())
+		leaderDone := serveInBackground(httptest.NewRecorder(), newGet().WithContext(ctx))
+		Eventually(upstreamCount.Load).Should(BeEquivalentTo(1))
+
+		follower := httptest.NewRecorder()
+		followerDone := serveInBackground(follower, newGet())
+		time.Sleep(50 * time.Millisecond)
+		cancel()
+		close(release)
+
+		Eventually(followerDone).Should(BeClosed())
+		Eventually(leaderDone).Should(BeClosed())
+		Expect(follower.Body.String()).To(Equal("shared body"))
+		Expect(upstreamCount.Load()).To(BeEquivalentTo(1))
+		Expect(upstreamCancelled.Load()).To(BeFalse())
+	})
+
+	It("cancels the request to the backend once every client has gone", func() {
+		ctx, cancel := context.WithCancel(context.Background())
+		leaderDone := serveInBackground(httptest.NewRecorder(), newGet().WithContext(ctx))
+		Eventually(upstreamCount.Load).Should(BeEquivalentTo(1))
+
+		cancel()
+		Eventually(leaderDone).Should(BeClosed())
+		Expect(upstreamCancelled.Load()).To(BeTrue())
+	})
+
+	It("does not coalesce requests with different key headers", func() {
+		serveConcurrently(newGet("Accept-Language", "en"), newGet("Accept-Language", "cy"))
+		Expect(upstreamCount.Load()).To(BeEquivalentTo(2))
+	})
+
+	It("does not coalesce requests with an Authorization header", func() {
+		serveConcurrently(newGet("Authorization", "Bearer x"), newGet("Authorization", "Bearer x"))
+		Expect(upstreamCount.Load()).To(BeEquivalentTo(2))
+	})
+
+	It("does not share private responses", func() {
+		header.Set("Cache-Control", "private")
+		serveConcurrently(newGet(), newGet())
+		Expect(upstreamCount.Load()).To(BeEquivalentTo(2))
+	})
+
+	It("does not share error responses", func() {
+		status = http.StatusInternalServerError
+		serveConcurrently(newGet(), newGet())
+		Expect(upstreamCount.Load()).To(BeEquivalentTo(2))
+	})
+
+	It("does not share responses without explicit freshness", func() {
+		header.Del("Cache-Control")
+		serveConcurrently(newGet(), newGet())
+		Expect(upstreamCount.Load()).To(BeEquivalentTo(2))
+	})
+
+	It("does not share event streams", func() {
+		header.Set("Content-Type", "text/event-stream")
+		recorders := serveConcurrently(newGet(), newGet())
+		Expect(upstreamCount.Load()).To(BeEquivalentTo(2))
+		for _, rr := range recorders {
+			Expect(rr.Body.String()).To(Equal("shared body"))
+		}
+	})
+
+	It("does not share responses for other variants", func() {
+		header.Set("Vary", "X-Variant")
+		serveConcurrently(newGet("X-Variant", "a"), newGet("X-Variant", "b"))
+		Expect(upstreamCount.Load()).To(BeEquivalentTo(2))
+	})
+
+	It("does not coalesce other methods", func() {
+		close(release)
+		for range 2 {
+			handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/page", nil))
+		}
+		Expect(upstreamCount.Load()).To(BeEquivalentTo(2))
+	})
+})
+
+// blockingRecorder is a ResponseRecorder for a slow client, whose writes
+// block until unblock is closed.
+type blockingRecorder struct {
+	*httptest.ResponseRecorder
+	unblock chan struct{}
+}
+
+func (br *blockingRecorder) Write(p []byte) (int, error) {
+	<-br.unblock
+	return br.ResponseRecorder.Write(p)
+}
@@ -0,0 +1,295 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Reasons that requests are rejected without being sent to a backend because
+// too many requests to it are in flight.
+const (
+	ReasonQueueFull    = "queue_full"
+	ReasonQueueTimeout = "queue_timeout"
+)
+
+// ConcurrencyLimit limits the number of requests in flight to a backend, so
+// that a slow backend can't tie up an unbounded number of connections.
+type ConcurrencyLimit struct {
+	// MaxInFlight is the number of requests that can be in flight to the
+	// backend at once, from sending the request until its response body has
+	// been read. It's unlimited if 0.
+	MaxInFlight int `json:"max_in_flight"`
+	// QueueSize is the number of requests that can wait for a request in
+	// flight to finish. Requests that arrive when the queue is full are
+	// rejected.
+	QueueSize int `json:"queue_size"`
+	// QueueTimeoutMs is the number of milliseconds that requests wait in the
+	// queue before they're rejected.
+	QueueTimeoutMs int `json:"queue_timeout_ms"`
+	// Adaptive adjusts the limit between a minimum and MaxInFlight according
+	// to the backend's latency, if set.
+	Adaptive *AdaptiveConcurrency `json:"adaptive"`
+}
+
+// AdaptiveConcurrency adjusts a backend's concurrency limit by additive
+// increase, multiplicative decrease (AIMD). The limit starts at MaxInFlight.
+// Each request that's slower than the latency threshold or fails, including
+// with a 5xx response from the backend, cuts it by the backoff factor, at most
+// once per threshold, and each request that's fast enough while the limit is
+// at least half used raises it, by one for every limit's worth of requests.
+type AdaptiveConcurrency struct {
+	// MinInFlight is the lowest that the limit goes, which defaults to 1.
+	MinInFlight int `json:"min_in_flight"`
+	// LatencyThresholdMs is the number of milliseconds that the backend can
+	// take to respond before the limit is lowered.
+	LatencyThresholdMs int `json:"latency_threshold_ms"`
+	// Backoff is the factor that the limit is multiplied by when it's
+	// lowered, which defaults to 0.9.
+	Backoff float64 `json:"backoff"`
+}
+
+// ConcurrencyLimitSet configures the concurrency limits for backends.
+type ConcurrencyLimitSet struct {
+	// Default is the limit for backends without one of their own.
+	Default ConcurrencyLimit `json:"default"`
+	// Backends maps backend IDs to the limit for that backend, which replaces
+	// the default.
+	Backends map[string]ConcurrencyLimit `json:"backends"`
+}
+
+// BackendConcurrencyLimits holds the concurrency limits for backends, or nil
+// if there are none.
+var BackendConcurrencyLimits *ConcurrencyLimitSet
+
+// LoadConcurrencyLimits reads the concurrency limits for backends from a JSON
+// file.
+func LoadConcurrencyLimits(path string) (*ConcurrencyLimitSet, error) {
+	data, err := os.ReadFile(path) //nolint:gosec // path is from ROUTER_BACKEND_CONCURRENCY_LIMITS_FILE env var, controlled by user
+	if err != nil {
+		return nil, fmt.Errorf("failed to read concurrency limits: %w", err)
+	}
+
+	set := &ConcurrencyLimitSet{}
+	if err := json.Unmarshal(data, set); err != nil {
+		return nil, fmt.Errorf("failed to parse concurrency limits: %w", err)
+	}
+
+	if err := set.Default.validate(); err != nil {
+		return nil, fmt.Errorf("invalid default concurrency limit: %w", err)
+	}
+	for backendID, limit := range set.Backends {
+		if err := limit.validate(); err != nil {
+			return nil, fmt.Errorf("invalid concurrency limit for backend %s: %w", backendID, err)
+		}
+	}
+	return set, nil
+}
+
+// ForBackend returns the concurrency limit for backendID.
+func (set *ConcurrencyLimitSet) ForBackend(backendID string) ConcurrencyLimit {
+	if set == nil {
+		return ConcurrencyLimit{}
+	}
+	if limit, ok := set.Backends[backendID]; ok {
+		return limit
+	}
+	return set.Default
+}
+
+func (limit ConcurrencyLimit) validate() error {
+	if limit.MaxInFlight < 0 || limit.QueueSize < 0 || limit.QueueTimeoutMs < 0 {
+		return errors.New("negative max_in_flight, queue_size or queue_timeout_ms")
+	}
+	if limit.QueueSize > 0 && limit.QueueTimeoutMs == 0 {
+		return errors.New("queue_size without queue_timeout_ms")
+	}
+	if adaptive := limit.Adaptive; adaptive != nil {
+		if limit.MaxInFlight == 0 {
+			return errors.New("adaptive without max_in_flight")
+		}
+		if adaptive.MinInFlight < 0 || adaptive.MinInFlight > limit.MaxInFlight {
+			return errors.New("adaptive min_in_flight not between 0 and max_in_flight")
+		}
+		if adaptive.LatencyThresholdMs <= 0 {
+			return errors.New("adaptive without latency_threshold_ms")
+		}
+		if adaptive.Backoff < 0 || adaptive.Backoff >= 1 {
+			return errors.New("adaptive backoff not between 0 and 1")
+		}
+	}
+	return nil
+}
+
+// concurrencyLimiter counts the requests in flight to a backend, queueing
+// requests over the limit.
+type concurrencyLimiter struct {
+	backendID    string
+	queueSize    int
+	queueTimeout time.Duration
+
+	mu       sync.Mutex
+	limit    int
+	inFlight int
+	waiters  []chan struct{}
+	adaptive *aimdLimit
+}
+
+// aimdLimit is the state of an adaptive concurrency limit.
+type aimdLimit struct {
+	min, max     float64
+	threshold    time.Duration
+	backoff      float64
+	current      float64
+	lastDecrease time.Time
+}
+
+// newConcurrencyLimiter returns a limiter for limit on backendID, or nil if
+// limit doesn't limit anything.
+func newConcurrencyLimiter(backendID string, limit ConcurrencyLimit) *concurrencyLimiter {
+	if limit.MaxInFlight == 0 {
+		return nil
+	}
+	l := &concurrencyLimiter{
+		backendID:    backendID,
+		queueSize:    limit.QueueSize,
+		queueTimeout: time.Duration(limit.QueueTimeoutMs) * time.Millisecond,
+	}
+	if adaptive := limit.Adaptive; adaptive != nil {
+		l.adaptive = &aimdLimit{
+			min:       float64(max(adaptive.MinInFlight, 1)),
+			max:       float64(limit.MaxInFlight),
+			threshold: time.Duration(adaptive.LatencyThresholdMs) * time.Millisecond,
+			backoff:   adaptive.Backoff,
+			current:   float64(limit.MaxInFlight),
+		}
+		if l.adaptive.backoff == 0 {
+			l.adaptive.backoff = 0.9
+		}
+	}
+	l.setLimit(limit.MaxInFlight)
+	return l
+}
+
+// acquire waits for a request to be allowed in flight, for up to the queue
+// timeout or until ctx is done. It returns how long the request waited, and
+// the reason the request was rejected if it wasn't allowed. Requests which
+// are allowed must call release when they finish.
+func (l *concurrencyLimiter) acquire(ctx context.Context) (time.Duration, string, bool) {
+	l.mu.Lock()
+	if l.inFlight < l.limit && len(l.waiters) == 0 {
+		l.inFlight++
+		l.mu.Unlock()
+		return 0, "", true
+	}
+	if len(l.waiters) >= l.queueSize {
+		l.mu.Unlock()
+		return 0, ReasonQueueFull, false
+	}
+	ready := make(chan struct{}, 1)
+	l.waiters = append(l.waiters, ready)
+	l.mu.Unlock()
+
+	start := time.Now()
+	timer := time.NewTimer(l.queueTimeout)
+	defer timer.Stop()
+
+	reason := ReasonQueueTimeout
+	select {
+	case <-ready:
+		return time.Since(start), "", true
+	case <-timer.C:
+	case <-ctx.Done():
+		reason = ReasonClientCancelled
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if i := slices.Index(l.waiters, ready); i >= 0 {
+		l.waiters = slices.Delete(l.waiters, i, i+1)
+		return time.Since(start), reason, false
+	}
+	// The request was allowed in flight while it was giving up
+	return time.Since(start), "", true
+}
+
+// release ends a request that was allowed in flight, letting the next queued
+// request go.
+func (l *concurrencyLimiter) release() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.inFlight--
+	l.admit()
+}
+
+// observe adjusts an adaptive limit after the backend took latency to
+// respond to a request, and failed is set if the response was a 5xx error. The same latencies are
+// recorded in the router_backend_handler_response_duration_seconds metric.
+func (l *concurrencyLimiter) observe(latency time.Duration, failed bool, now time.Time) {
+	if l.adaptive == nil {
+		return
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	a := l.adaptive
+	switch {
+	case failed || latency > a.threshold:
+		// Requests that were already in flight when the backend slowed down
+		// will be slow too, so don't count them against the new limit
+		if now.Sub(a.lastDecrease) < a.threshold {
+			return
+		}
+		a.current = max(a.min, a.current*a.backoff)
+		a.lastDecrease = now
+	case l.inFlight*2 >= l.limit:
+		a.current = min(a.max, a.current+1/a.current)
+	default:
+		// The limit isn't holding requests back, so there's no need to raise it
+		return
+	}
+	l.setLimit(int(a.current))
+}
+
+// setLimit changes the limit, letting queued requests go if it's been raised.
+// It must be called with l.mu held, unless l is new.
+func (l *concurrencyLimiter) setLimit(limit int) {
+	if limit == l.limit {
+		return
+	}
+	l.limit = limit
+	concurrencyLimitMetric.With(prometheus.Labels{"backend_id": l.backendID}).Set(float64(limit))
+	l.admit()
+}
+
+// admit lets queued requests go while there is room under the limit. It must
+// be called with l.mu held.
+func (l *concurrencyLimiter) admit() {
+	for len(l.waiters) > 0 && l.inFlight < l.limit {
+		l.inFlight++
+		l.waiters[0] <- struct{}{}
+		l.waiters = l.waiters[1:]
+	}
+}
+
+// releasingBody releases a request's place in flight when its response body
+// is closed.
+type releasingBody struct {
+	io.ReadCloser
+	once    sync.Once
+	release func()
+}
+
+func (b *releasingBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.once.Do(b.release)
+	return err
+}
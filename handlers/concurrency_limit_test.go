@@ -0,0 +1,294 @@
+package handlers
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/prometheus/client_golang/prometheus"
+	promtest "github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/rs/zerolog"
+)
+
+var _ = Describe("Concurrency limits", func() {
+	Describe("concurrencyLimiter", func() {
+		var limiter *concurrencyLimiter
+
+		BeforeEach(func() {
+			limiter = newConcurrencyLimiter("backend", ConcurrencyLimit{MaxInFlight: 1, QueueSize: 1, QueueTimeoutMs: 50})
+		})
+
+		It("doesn't limit backends without a maximum", func() {
+			Expect(newConcurrencyLimiter("backend", ConcurrencyLimit{})).To(BeNil())
+		})
+
+		It("queues requests over the limit until one finishes", func() {
+			_, _, ok := limiter.acquire(context.Background())
+			Expect(ok).To(BeTrue())
+
+			admitted := make(chan bool)
+			go func() {
+				_, _, ok := limiter.acquire(context.Background())
+				admitted <- ok
+			}()
+			Eventually(func() int {
+				limiter.mu.Lock()
+				defer limiter.mu.Unlock()
+				return len(limiter.waiters)
+			}).Should(Equal(1))
+
+			_, reason, ok := limiter.acquire(context.Background())
+			Expect(ok).To(BeFalse())
+			Expect(reason).To(Equal(ReasonQueueFull))
+
+			limiter.release()
+			Expect(<-admitted).To(BeTrue())
+			Expect(limiter.inFlight).To(Equal(1))
+		})
+
+		It("rejects requests which time out in the queue", func() {
+			_, _, ok := limiter.acquire(context.Background())
+			Expect(ok).To(BeTrue())
+
+			wait, reason, ok := limiter.acquire(context.Background())
+			Expect(ok).To(BeFalse())
+			Expect(reason).To(Equal(ReasonQueueTimeout))
+			Expect(wait).To(BeNumerically(">=", 50*time.Millisecond))
+			Expect(limiter.waiters).To(BeEmpty())
+		})
+
+		It("rejects requests whose client goes away while queued", func() {
+			_, _, ok := limiter.acquire(context.Background())
+			Expect(ok).To(BeTrue())
+
+			ctx, cancel := context.WithCancel(context.Background())
+			cancel()
+			_, reason, ok := limiter.acquire(ctx)
+			Expect(ok).To(BeFalse())
+			Expect(reason).To(Equal(ReasonClientCancelled))
+		})
+	})
+
+	Describe("adaptive limits", func() {
+		var (
+			limiter *concurrencyLimiter
+			now     time.Time
+		)
+
+		BeforeEach(func() {
+			limiter = newConcurrencyLimiter("backend-adaptive", ConcurrencyLimit{
+				MaxInFlight:    10,
+				QueueSize:      5,
+				QueueTimeoutMs: 1000,
+				Adaptive:       &AdaptiveConcurrency{MinInFlight: 5, LatencyThresholdMs: 100, Backoff: 0.5},
+			})
+			now = time.Now()
+		})
+
+		It("lowers the limit once per threshold while the backend is slow", func() {
+			limiter.observe(200*time.Millisecond, false, now)
+			Expect(limiter.limit).To(Equal(5))
+			Expect(promtest.ToFloat64(concurrencyLimitMetric.With(prometheus.Labels{"backend_id": "backend-adaptive"}))).To(Equal(5.0))
+
+			limiter.observe(0, true, now.Add(50*time.Millisecond))
+			Expect(limiter.limit).To(Equal(5))
+
+			limiter.observe(0, true, now.Add(time.Second))
+			Expect(limiter.limit).To(Equal(5))
+		})
+
+		It("raises the limit while it's in use and the backend is fast, letting queued requests go", func() {
+			limiter.observe(200*time.Millisecond, false, now)
+			for range 5 {
+				_, _, ok := limiter.acquire(context.Background())
+				Expect(ok).To(BeTrue())
+			}
+			admitted := make(chan bool)
+			go func() {
+				_, _, ok := limiter.acquire(context.Background())
+				admitted <- ok
+			}()
+			Eventually(func() int {
+				limiter.mu.Lock()
+				defer limiter.mu.Unlock()
+				return len(limiter.waiters)
+			}).Should(Equal(1))
+
+			for range 6 {
+				limiter.observe(10*time.Millisecond, false, now)
+			}
+			Expect(<-admitted).To(BeTrue())
+			Expect(limiter.limit).To(Equal(6))
+
+			for range 100 {
+				limiter.observe(10*time.Millisecond, false, now)
+			}
+			Expect(limiter.limit).To(Equal(10))
+		})
+
+		It("doesn't raise the limit while it's mostly unused", func() {
+			limiter.observe(200*time.Millisecond, false, now)
+			for range 100 {
+				limiter.observe(10*time.Millisecond, false, now)
+			}
+			Expect(limiter.limit).To(Equal(5))
+		})
+	})
+
+	Describe("backend handler", func() {
+		var (
+			backendURL *url.URL
+			arrived    chan struct{}
+			unblock    chan struct{}
+		)
+
+		BeforeEach(func() {
+			arrived = make(chan struct{})
+			unblock = make(chan struct{})
+			// Hijacked connections outlive the backend, so it uses this spec's channels
+			arrived, unblock := arrived, unblock
+			backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				switch r.URL.Path {
+				case "/slow":
+					close(arrived)
+					<-unblock
+				case "/unavailable":
+					w.WriteHeader(http.StatusServiceUnavailable)
+					return
+				case "/upgrade":
+					conn, brw, err := http.NewResponseController(w).Hijack()
+					if err != nil {
+						return
+					}
+					defer conn.Close()
+					_, _ = brw.WriteString("HTTP/1.1 101 Switching Protocols\r\nConnection: Upgrade\r\nUpgrade: echo\r\n\r\n")
+					_ = brw.Flush()
+					<-unblock
+					return
+				}
+				w.WriteHeader(http.StatusOK)
+			}))
+			DeferCleanup(backend.Close)
+
+			var err error
+			backendURL, err = url.Parse(backend.URL)
+			Expect(err).NotTo(HaveOccurred())
+
+			BackendConcurrencyLimits = &ConcurrencyLimitSet{
+				Default: ConcurrencyLimit{MaxInFlight: 1},
+			}
+			EnableRouterErrorHeader = true
+		})
+
+		AfterEach(func() {
+			BackendConcurrencyLimits = nil
+			EnableRouterErrorHeader = false
+		})
+
+		It("sheds requests over the limit with 503 until a request finishes", func() {
+			lbls := prometheus.Labels{"backend_id": "backend-limited", "reason": ReasonQueueFull}
+			before := promtest.ToFloat64(shedRequestCountMetric.With(lbls))
+
+			handler := NewBackendHandler("backend-limited", backendURL, time.Second, time.Second, zerolog.Nop())
+
+			slow := make(chan int)
+			go func() {
+				defer GinkgoRecover()
+				rr := httptest.NewRecorder()
+				handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/slow", nil))
+				slow <- rr.Code
+			}()
+
+			Eventually(arrived).Should(BeClosed())
+
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/fast", nil))
+			Expect(rr.Code).To(Equal(http.StatusServiceUnavailable))
+			Expect(rr.Header().Get(RouterErrorHeader)).To(Equal(ReasonQueueFull))
+
+			close(unblock)
+			Expect(<-slow).To(Equal(http.StatusOK))
+
+			rr = httptest.NewRecorder()
+			handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/fast", nil))
+			Expect(rr.Code).To(Equal(http.StatusOK))
+			Expect(promtest.ToFloat64(shedRequestCountMetric.With(lbls)) - before).To(BeNumerically("~", 1.0))
+		})
+
+		It("doesn't count upgraded connections against the limit", func() {
+			server := httptest.NewServer(NewBackendHandler("backend-upgrade-limited", backendURL, time.Second, time.Second, zerolog.Nop()))
+			defer server.Close()
+			defer close(unblock)
+
+			conn, err := net.Dial("tcp", server.Listener.Addr().String())
+			Expect(err).NotTo(HaveOccurred())
+			defer conn.Close()
+			Expect(conn.SetDeadline(time.Now().Add(time.Second))).To(Succeed())
+			_, err = fmt.Fprint(conn, "GET /upgrade HTTP/1.1\r\nHost: www.gov.uk\r\nConnection: Upgrade\r\nUpgrade: echo\r\n\r\n")
+			Expect(err).NotTo(HaveOccurred())
+			resp, err := http.ReadResponse(bufio.NewReader(conn), nil)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(resp.StatusCode).To(Equal(http.StatusSwitchingProtocols))
+
+			resp, err = http.Get(server.URL + "/fast")
+			Expect(err).NotTo(HaveOccurred())
+			resp.Body.Close()
+			Expect(resp.StatusCode).To(Equal(http.StatusOK))
+		})
+
+		It("lowers an adaptive limit when the backend responds quickly with 5xx errors", func() {
+			BackendConcurrencyLimits.Default = ConcurrencyLimit{
+				MaxInFlight: 10,
+				Adaptive:    &AdaptiveConcurrency{LatencyThresholdMs: 1000, Backoff: 0.5},
+			}
+			handler := NewBackendHandler("backend-adaptive-unavailable", backendURL, time.Second, time.Second, zerolog.Nop())
+
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/unavailable", nil))
+			Expect(rr.Code).To(Equal(http.StatusServiceUnavailable))
+			Expect(promtest.ToFloat64(concurrencyLimitMetric.With(prometheus.Labels{"backend_id": "backend-adaptive-unavailable"}))).To(Equal(5.0))
+		})
+
+		It("uses a backend's own limit instead of the default", func() {
+			BackendConcurrencyLimits.Backends = map[string]ConcurrencyLimit{"backend-unlimited": {}}
+			handler := NewBackendHandler("backend-unlimited", backendURL, time.Second, time.Second, zerolog.Nop())
+
+			go func() {
+				handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/slow", nil))
+			}()
+			defer close(unblock)
+			Eventually(arrived).Should(BeClosed())
+
+			Consistently(func() int {
+				rr := httptest.NewRecorder()
+				handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/fast", nil))
+				return rr.Code
+			}, 100*time.Millisecond).Should(Equal(http.StatusOK))
+		})
+	})
+
+	DescribeTable("rejects invalid limits",
+		func(content string) {
+			path := filepath.Join(GinkgoT().TempDir(), "concurrency-limits.json")
+			Expect(os.WriteFile(path, []byte(content), 0o600)).To(Succeed())
+			_, err := LoadConcurrencyLimits(path)
+			Expect(err).To(HaveOccurred())
+		},
+		Entry("negative maximum", `{"default": {"max_in_flight": -1}}`),
+		Entry("queue without a timeout", `{"backends": {"search-api": {"max_in_flight": 10, "queue_size": 5}}}`),
+		Entry("adaptive without a maximum", `{"default": {"adaptive": {"latency_threshold_ms": 500}}}`),
+		Entry("adaptive minimum over the maximum", `{"default": {"max_in_flight": 10, "adaptive": {"min_in_flight": 20, "latency_threshold_ms": 500}}}`),
+		Entry("adaptive without a latency threshold", `{"default": {"max_in_flight": 10, "adaptive": {}}}`),
+		Entry("adaptive backoff of 1", `{"default": {"max_in_flight": 10, "adaptive": {"latency_threshold_ms": 500, "backoff": 1}}}`),
+		Entry("not an object", `[]`),
+	)
+})
@@ -0,0 +1,215 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// ErrorPages, if set, is used to render the bodies of error responses that
+// Router generates itself, rather than the bare responses it otherwise sends.
+var ErrorPages *ErrorPageSet
+
+// ErrorPageSet holds the error page templates loaded from disk, keyed by
+// status code, with optional overrides per backend.
+type ErrorPageSet struct {
+	pages        map[int]*template.Template
+	backendPages map[string]map[int]*template.Template
+}
+
+type errorPageData struct {
+	Status     int    `json:"status"`
+	StatusText string `json:"error"`
+	Path       string `json:"path"`
+	BackendID  string `json:"backend_id,omitempty"`
+	Reason     string `json:"reason,omitempty"`
+
+	// Details of gone routes
+	AlternativePath string        `json:"alternative_path,omitempty"`
+	Explanation     template.HTML `json:"explanation,omitempty"`
+	WithdrawnAt     string        `json:"withdrawn_at,omitempty"`
+	WithdrawnDate   string        `json:"-"`
+}
+
+var reErrorPageFile = regexp.MustCompile(`^([1-5]\d\d)\.html$`)
+
+/*
+LoadErrorPages parses error page templates from dir. Templates are named
+after the status they are used for, and templates in a subdirectory named
+after a backend are used in preference for errors from that backend:
+
+	dir/404.html
+	dir/502.html
+	dir/frontend/502.html
+*/
+func LoadErrorPages(dir string) (*ErrorPageSet, error) {
+	pages, err := loadErrorPageDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	set := &ErrorPageSet{
+		pages:        pages,
+		backendPages: make(map[string]map[int]*template.Template),
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read error pages directory: %w", err)
+	}
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		pages, err := loadErrorPageDir(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+		set.backendPages[entry.Name()] = pages
+	}
+
+	return set, nil
+}
+
+func loadErrorPageDir(dir string) (map[int]*template.Template, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read error pages directory: %w", err)
+	}
+
+	pages := make(map[int]*template.Template)
+	for _, entry := range entries {
+		match := reErrorPageFile.FindStringSubmatch(entry.Name())
+		if entry.IsDir() || match == nil {
+			continue
+		}
+		status, _ := strconv.Atoi(match[1])
+
+		tmpl, err := template.ParseFiles(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse error page %s: %w", entry.Name(), err)
+		}
+		pages[status] = tmpl
+	}
+	return pages, nil
+}
+
+// Count returns the number of error page templates in the set.
+func (set *ErrorPageSet) Count() int {
+	count := len(set.pages)
+	for _, pages := range set.backendPages {
+		count += len(pages)
+	}
+	return count
+}
+
+/*
+Render returns the content type and body of the error page for the given
+status. Clients which prefer JSON get a JSON representation of the error,
+otherwise the HTML template for the backend (or the default for the status)
+is used. ok is false if there is no page to render, in which case the
+caller should fall back to its usual response.
+*/
+func (set *ErrorPageSet) Render(r *http.Request, status int, backendID, reason string) (contentType string, body []byte, ok bool) {
+	if set == nil {
+		return "", nil, false
+	}
+
+	return renderErrorPage(set, r, errorPageData{
+		Status:     status,
+		StatusText: http.StatusText(status),
+		Path:       r.URL.Path,
+		BackendID:  backendID,
+		Reason:     reason,
+	})
+}
+
+// renderErrorPage renders data as JSON for clients which prefer it, or with
+// the HTML template from set (which may be nil) for the backend and status.
+func renderErrorPage(set *ErrorPageSet, r *http.Request, data errorPageData) (contentType string, body []byte, ok bool) {
+	if prefersJSON(r) {
+		body, err := json.Marshal(data)
+		if err != nil {
+			return "", nil, false
+		}
+		return "application/json; charset=utf-8", append(body, '\n'), true
+	}
+
+	if set == nil {
+		return "", nil, false
+	}
+	tmpl, ok := set.backendPages[data.BackendID][data.Status]
+	if !ok {
+		tmpl, ok = set.pages[data.Status]
+	}
+	if !ok {
+		return "", nil, false
+	}
+
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return "", nil, false
+	}
+	return "text/html; charset=utf-8", buf.Bytes(), true
+}
+
+// ServeErrorPage writes the configured error page for status, if there is
+// one, and reports whether it did so.
+func ServeErrorPage(w http.ResponseWriter, r *http.Request, status int) bool {
+	contentType, body, ok := ErrorPages.Render(r, status, "", "")
+	if !ok {
+		return false
+	}
+
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(status)
+	_, _ = w.Write(body)
+	return true
+}
+
+// prefersJSON reports whether the Accept header of r ranks application/json
+// above text/html. An explicit application/json beats a wildcard of the same
+// quality, so "application/json, */*" is treated as a request for JSON.
+func prefersJSON(r *http.Request) bool {
+	jsonQ, htmlQ, wildcardQ := -1.0, -1.0, -1.0
+
+	for _, part := range strings.Split(r.Header.Get("Accept"), ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+
+		q := 1.0
+		if v, ok := params["q"]; ok {
+			if q, err = strconv.ParseFloat(v, 64); err != nil {
+				continue
+			}
+		}
+
+		switch mediaType {
+		case "application/json":
+			jsonQ = max(jsonQ, q)
+		case "text/html":
+			htmlQ = max(htmlQ, q)
+		case "text/*", "*/*":
+			wildcardQ = max(wildcardQ, q)
+		}
+	}
+
+	if jsonQ <= 0 {
+		return false
+	}
+	if htmlQ >= 0 {
+		return jsonQ > htmlQ
+	}
+	return jsonQ >= wildcardQ
+}
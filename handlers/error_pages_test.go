@@ -0,0 +1,129 @@
+package handlers
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/rs/zerolog"
+)
+
+var _ = Describe("Error pages", func() {
+	var (
+		dir string
+		rr  *httptest.ResponseRecorder
+	)
+
+	writePage := func(name, content string) {
+		path := filepath.Join(dir, name)
+		Expect(os.MkdirAll(filepath.Dir(path), 0o750)).To(Succeed())
+		Expect(os.WriteFile(path, []byte(content), 0o600)).To(Succeed())
+	}
+
+	BeforeEach(func() {
+		dir = GinkgoT().TempDir()
+		rr = httptest.NewRecorder()
+
+		writePage("404.html", "<h1>{{.StatusText}}: {{.Path}}</h1>")
+		writePage("502.html", "<h1>Default {{.Status}}</h1>")
+		writePage("frontend/502.html", "<h1>Frontend {{.Status}} {{.Reason}}</h1>")
+		writePage("README.md", "ignored")
+	})
+
+	AfterEach(func() {
+		ErrorPages = nil
+	})
+
+	It("loads templates for each status and backend", func() {
+		pages, err := LoadErrorPages(dir)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(pages.Count()).To(Equal(3))
+	})
+
+	It("fails to load invalid templates", func() {
+		writePage("500.html", "{{.Status")
+		_, err := LoadErrorPages(dir)
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("fails to load a missing directory", func() {
+		_, err := LoadErrorPages(filepath.Join(dir, "missing"))
+		Expect(err).To(HaveOccurred())
+	})
+
+	Context("when error pages are configured", func() {
+		BeforeEach(func() {
+			var err error
+			ErrorPages, err = LoadErrorPages(dir)
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		It("renders the HTML template for the status", func() {
+			Expect(ServeErrorPage(rr, httptest.NewRequest(http.MethodGet, "/missing<page>", nil), http.StatusNotFound)).To(BeTrue())
+			Expect(rr.Code).To(Equal(http.StatusNotFound))
+			Expect(rr.Header().Get("Content-Type")).To(Equal("text/html; charset=utf-8"))
+			Expect(rr.Body.String()).To(Equal("<h1>Not Found: /missing&lt;page&gt;</h1>"))
+		})
+
+		It("renders JSON for clients that prefer it", func() {
+			req := httptest.NewRequest(http.MethodGet, "/missing", nil)
+			req.Header.Set("Accept", "application/json, */*")
+			Expect(ServeErrorPage(rr, req, http.StatusNotFound)).To(BeTrue())
+			Expect(rr.Header().Get("Content-Type")).To(Equal("application/json; charset=utf-8"))
+			Expect(rr.Body.String()).To(MatchJSON(`{"status": 404, "error": "Not Found", "path": "/missing"}`))
+		})
+
+		It("does nothing when there is no template for the status", func() {
+			Expect(ServeErrorPage(rr, httptest.NewRequest(http.MethodGet, "/", nil), http.StatusGone)).To(BeFalse())
+			Expect(rr.Body.String()).To(BeEmpty())
+		})
+
+		It("prefers the backend's template", func() {
+			_, body, ok := ErrorPages.Render(httptest.NewRequest(http.MethodGet, "/", nil), http.StatusBadGateway, "frontend", ReasonTimeout)
+			Expect(ok).To(BeTrue())
+			Expect(string(body)).To(Equal("<h1>Frontend 502 timeout</h1>"))
+
+			_, body, ok = ErrorPages.Render(httptest.NewRequest(http.MethodGet, "/", nil), http.StatusBadGateway, "publisher", ReasonTimeout)
+			Expect(ok).To(BeTrue())
+			Expect(string(body)).To(Equal("<h1>Default 502</h1>"))
+		})
+
+		It("renders errors from backend handlers", func() {
+			l, err := net.Listen("tcp", "127.0.0.1:0")
+			Expect(err).NotTo(HaveOccurred())
+			backendURL, err := url.Parse("http://" + l.Addr().String())
+			Expect(err).NotTo(HaveOccurred())
+			Expect(l.Close()).To(Succeed())
+
+			router := NewBackendHandler("frontend", backendURL, time.Second, time.Second, zerolog.Nop())
+			router.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, backendURL.String(), nil))
+
+			Expect(rr.Code).To(Equal(http.StatusBadGateway))
+			Expect(rr.Body.String()).To(Equal("<h1>Frontend 502 connection_refused</h1>"))
+		})
+	})
+
+	It("does nothing when error pages are not configured", func() {
+		Expect(ServeErrorPage(rr, httptest.NewRequest(http.MethodGet, "/", nil), http.StatusNotFound)).To(BeFalse())
+	})
+
+	DescribeTable("prefersJSON",
+		func(accept string, expected bool) {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.Header.Set("Accept", accept)
+			Expect(prefersJSON(req)).To(Equal(expected))
+		},
+		Entry("no Accept header", "", false),
+		Entry("browser", "text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8", false),
+		Entry("JSON only", "application/json", true),
+		Entry("JSON with wildcard", "application/json, text/plain, */*", true),
+		Entry("HTML preferred over JSON", "application/json;q=0.5, text/html", false),
+		Entry("JSON preferred over HTML", "application/json, text/html;q=0.5", true),
+	)
+})
@@ -0,0 +1,110 @@
+package handlers
+
+import (
+	"bytes"
+	"fmt"
+	"html/template"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// RenderGonePages makes Router render the pages for gone routes which have
+// details itself, rather than sending them to a backend.
+var RenderGonePages bool
+
+// GoneDetails are the details of a gone route which explain why the page has
+// gone and where to find a replacement.
+type GoneDetails struct {
+	// AlternativePath is a path or URL where a replacement for the page can
+	// be found.
+	AlternativePath string `json:"alternative_path"`
+	// Explanation is HTML from the publisher explaining why the page has gone.
+	Explanation string `json:"explanation"`
+	// WithdrawnAt is when the page was withdrawn, as an RFC 3339 timestamp.
+	WithdrawnAt string `json:"withdrawn_at"`
+}
+
+var defaultGonePage = template.Must(template.New("410.html").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>This page has been removed</title>
+</head>
+<body>
+<h1>This page has been removed</h1>
+{{with .WithdrawnDate}}<p>It was withdrawn on {{.}}.</p>
+{{end}}{{with .Explanation}}<div>{{.}}</div>
+{{end}}{{with .AlternativePath}}<p>You can find related information at <a href="{{.}}">{{.}}</a>.</p>
+{{end}}</body>
+</html>
+`))
+
+type goneHandler struct {
+	details *GoneDetails
+}
+
+// NewGoneHandler returns a handler that responds with 410 Gone. If details is
+// nil the response is the 410 error page, otherwise it is a page rendered
+// from details, using the 410 error page template if there is one.
+func NewGoneHandler(details *GoneDetails) http.Handler {
+	if details != nil && !isAlternativePath(details.AlternativePath) {
+		withoutPath := *details
+		withoutPath.AlternativePath = ""
+		details = &withoutPath
+	}
+	return &goneHandler{details}
+}
+
+// isAlternativePath reports whether path is safe to link to: a path on this
+// site or an HTTP(S) URL.
+func isAlternativePath(path string) bool {
+	u, err := url.Parse(path)
+	if err != nil || path == "" || strings.ContainsAny(path, "<>") {
+		return false
+	}
+	if u.Scheme == "" && u.Host == "" {
+		return len(u.Path) > 0 && u.Path[0] == '/'
+	}
+	return (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+}
+
+func (handler *goneHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if handler.details == nil {
+		if !ServeErrorPage(w, r, http.StatusGone) {
+			http.Error(w, "410 Gone", http.StatusGone)
+		}
+		return
+	}
+
+	data := errorPageData{
+		Status:          http.StatusGone,
+		StatusText:      http.StatusText(http.StatusGone),
+		Path:            r.URL.Path,
+		AlternativePath: handler.details.AlternativePath,
+		Explanation:     template.HTML(handler.details.Explanation), //nolint:gosec // explanations are HTML from publishers
+		WithdrawnAt:     handler.details.WithdrawnAt,
+	}
+	if t, err := time.Parse(time.RFC3339, data.WithdrawnAt); err == nil {
+		data.WithdrawnDate = t.Format("2 January 2006")
+	}
+
+	contentType, body, ok := renderErrorPage(ErrorPages, r, data)
+	if !ok {
+		var buf bytes.Buffer
+		if err := defaultGonePage.Execute(&buf, data); err != nil {
+			http.Error(w, "410 Gone", http.StatusGone)
+			return
+		}
+		contentType, body = "text/html; charset=utf-8", buf.Bytes()
+	}
+
+	if data.AlternativePath != "" {
+		w.Header().Set("Link", fmt.Sprintf("<%s>; rel=\"alternate\"", data.AlternativePath))
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(http.StatusGone)
+	_, _ = w.Write(body)
+}
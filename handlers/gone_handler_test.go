@@ -0,0 +1,96 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Gone handler", func() {
+	var (
+		rr      *httptest.ResponseRecorder
+		req     *http.Request
+		details *GoneDetails
+	)
+
+	BeforeEach(func() {
+		rr = httptest.NewRecorder()
+		req = httptest.NewRequest(http.MethodGet, "/old-page", nil)
+		details = &GoneDetails{
+			AlternativePath: "/new-page",
+			Explanation:     "<p>This guidance has been <em>replaced</em>.</p>",
+			WithdrawnAt:     "2024-03-05T10:00:00Z",
+		}
+	})
+
+	AfterEach(func() {
+		ErrorPages = nil
+	})
+
+	It("responds with a bare 410 when there are no details", func() {
+		NewGoneHandler(nil).ServeHTTP(rr, req)
+		Expect(rr.Code).To(Equal(http.StatusGone))
+		Expect(rr.Body.String()).To(Equal("410 Gone\n"))
+		Expect(rr.Header().Get("Link")).To(BeEmpty())
+	})
+
+	It("renders an HTML page from the details", func() {
+		NewGoneHandler(details).ServeHTTP(rr, req)
+		Expect(rr.Code).To(Equal(http.StatusGone))
+		Expect(rr.Header().Get("Content-Type")).To(Equal("text/html; charset=utf-8"))
+		Expect(rr.Header().Get("Link")).To(Equal(`</new-page>; rel="alternate"`))
+		Expect(rr.Body.String()).To(SatisfyAll(
+			ContainSubstring("<p>This guidance has been <em>replaced</em>.</p>"),
+			ContainSubstring("withdrawn on 5 March 2024"),
+			ContainSubstring(`<a href="/new-page">`),
+		))
+	})
+
+	It("renders JSON for clients which prefer it", func() {
+		req.Header.Set("Accept", "application/json")
+		NewGoneHandler(details).ServeHTTP(rr, req)
+		Expect(rr.Code).To(Equal(http.StatusGone))
+		Expect(rr.Header().Get("Content-Type")).To(Equal("application/json; charset=utf-8"))
+
+		var body map[string]any
+		Expect(json.Unmarshal(rr.Body.Bytes(), &body)).To(Succeed())
+		Expect(body).To(Equal(map[string]any{
+			"status":           410.0,
+			"error":            "Gone",
+			"path":             "/old-page",
+			"alternative_path": "/new-page",
+			"explanation":      "<p>This guidance has been <em>replaced</em>.</p>",
+			"withdrawn_at":     "2024-03-05T10:00:00Z",
+		}))
+	})
+
+	It("uses the 410 error page template if there is one", func() {
+		dir := GinkgoT().TempDir()
+		Expect(os.WriteFile(filepath.Join(dir, "410.html"), []byte(`<h1>Gone</h1>{{.Explanation}} <a href="{{.AlternativePath}}">next</a>`), 0o600)).To(Succeed())
+		pages, err := LoadErrorPages(dir)
+		Expect(err).NotTo(HaveOccurred())
+		ErrorPages = pages
+
+		NewGoneHandler(details).ServeHTTP(rr, req)
+		Expect(rr.Body.String()).To(Equal(`<h1>Gone</h1><p>This guidance has been <em>replaced</em>.</p> <a href="/new-page">next</a>`))
+	})
+
+	DescribeTable("only links to safe alternative paths",
+		func(path string, expectedLink string) {
+			details.AlternativePath = path
+			NewGoneHandler(details).ServeHTTP(rr, req)
+			Expect(rr.Header().Get("Link")).To(Equal(expectedLink))
+		},
+		Entry("path", "/new-page?q=1", `</new-page?q=1>; rel="alternate"`),
+		Entry("HTTPS URL", "https://example.com/page", `<https://example.com/page>; rel="alternate"`),
+		Entry("relative path", "new-page", ""),
+		Entry("javascript URL", "javascript:alert(1)", ""),
+		Entry("header injection", "/new\r\nSet-Cookie: a=b", ""),
+		Entry("angle brackets", "/new>; rel=\"next\"", ""),
+	)
+})
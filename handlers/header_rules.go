@@ -0,0 +1,162 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+)
+
+// Header operations say what a header rule does to a header.
+const (
+	// HeaderOpSet replaces any values of the header with the value.
+	HeaderOpSet = "set"
+	// HeaderOpAppend adds the value to any values the header already has.
+	HeaderOpAppend = "append"
+	// HeaderOpRemove removes the header.
+	HeaderOpRemove = "remove"
+	// HeaderOpRename moves the values of the header to the header named To.
+	HeaderOpRename = "rename"
+)
+
+// HeaderRule is an operation on a request or response header.
+type HeaderRule struct {
+	Op    string `json:"op"`
+	Name  string `json:"name"`
+	Value string `json:"value"`
+	To    string `json:"to"`
+}
+
+// HeaderRules are the operations applied to the requests sent to a backend
+// and to the responses it returns, in order.
+type HeaderRules struct {
+	Request  []HeaderRule `json:"request"`
+	Response []HeaderRule `json:"response"`
+}
+
+// HeaderRuleSet holds the header rules for backends.
+type HeaderRuleSet struct {
+	// Default rules apply to every backend, before the backend's own rules.
+	Default HeaderRules `json:"default"`
+	// Backends maps backend IDs to the rules for that backend.
+	Backends map[string]HeaderRules `json:"backends"`
+}
+
+// BackendHeaderRules holds the header rules for backends, or nil if there are
+// none.
+var BackendHeaderRules *HeaderRuleSet
+
+// LoadHeaderRules reads the header rules for backends from a JSON file.
+func LoadHeaderRules(path string) (*HeaderRuleSet, error) {
+	data, err := os.ReadFile(path) //nolint:gosec // path is from ROUTER_HEADER_RULES_FILE env var, controlled by user
+	if err != nil {
+		return nil, fmt.Errorf("failed to read header rules: %w", err)
+	}
+
+	set := &HeaderRuleSet{}
+	if err := json.Unmarshal(data, set); err != nil {
+		return nil, fmt.Errorf("failed to parse header rules: %w", err)
+	}
+
+	if err := set.Default.validate(); err != nil {
+		return nil, fmt.Errorf("invalid default header rules: %w", err)
+	}
+	for backendID, rules := range set.Backends {
+		if err := rules.validate(); err != nil {
+			return nil, fmt.Errorf("invalid header rules for backend %s: %w", backendID, err)
+		}
+	}
+
+	return set, nil
+}
+
+// ForBackend returns the default rules followed by the rules for backendID.
+func (set *HeaderRuleSet) ForBackend(backendID string) HeaderRules {
+	if set == nil {
+		return HeaderRules{}
+	}
+	return set.Default.merge(set.Backends[backendID])
+}
+
+// validate returns an error if any of the rules has an unknown operation or
+// an invalid header name or value.
+func (rules HeaderRules) validate() error {
+	for _, rule := range slices.Concat(rules.Request, rules.Response) {
+		if err := rule.validate(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (rule HeaderRule) validate() error {
+	if !validHeaderName(rule.Name) {
+		return fmt.Errorf("invalid header name %q", rule.Name)
+	}
+	switch rule.Op {
+	case HeaderOpSet, HeaderOpAppend:
+		if strings.ContainsAny(rule.Value, "\r\n") {
+			return fmt.Errorf("invalid value for header %s", rule.Name)
+		}
+	case HeaderOpRemove:
+	case HeaderOpRename:
+		if !validHeaderName(rule.To) {
+			return fmt.Errorf("invalid header name %q to rename %s to", rule.To, rule.Name)
+		}
+	default:
+		return fmt.Errorf("invalid header operation %q", rule.Op)
+	}
+	return nil
+}
+
+func validHeaderName(name string) bool {
+	return name != "" && !strings.ContainsAny(name, " :\t\r\n")
+}
+
+// merge returns rules followed by other.
+func (rules HeaderRules) merge(other HeaderRules) HeaderRules {
+	return HeaderRules{
+		Request:  slices.Concat(rules.Request, other.Request),
+		Response: slices.Concat(rules.Response, other.Response),
+	}
+}
+
+func applyHeaderRules(header http.Header, rules []HeaderRule) {
+	for _, rule := range rules {
+		switch rule.Op {
+		case HeaderOpSet:
+			header.Set(rule.Name, rule.Value)
+		case HeaderOpAppend:
+			header.Add(rule.Name, rule.Value)
+		case HeaderOpRemove:
+			header.Del(rule.Name)
+		case HeaderOpRename:
+			if values := header.Values(rule.Name); len(values) > 0 {
+				header.Del(rule.Name)
+				header[http.CanonicalHeaderKey(rule.To)] = values
+			}
+		}
+	}
+}
+
+type routeHeaderRulesKey struct{}
+
+// NewHeaderRulesHandler returns a handler that passes requests to next with
+// the rules for a route, which backend handlers apply after the backend's own
+// rules. It returns an error if the rules aren't valid.
+func NewHeaderRulesHandler(rules HeaderRules, next http.Handler) (http.Handler, error) {
+	if err := rules.validate(); err != nil {
+		return nil, err
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), routeHeaderRulesKey{}, rules)))
+	}), nil
+}
+
+func routeHeaderRules(ctx context.Context) HeaderRules {
+	rules, _ := ctx.Value(routeHeaderRulesKey{}).(HeaderRules)
+	return rules
+}
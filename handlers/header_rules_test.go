@@ -0,0 +1,130 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/onsi/gomega/ghttp"
+	"github.com/rs/zerolog"
+)
+
+var _ = Describe("Header rules", func() {
+	loadRules := func(content string) (*HeaderRuleSet, error) {
+		path := filepath.Join(GinkgoT().TempDir(), "header-rules.json")
+		Expect(os.WriteFile(path, []byte(content), 0o600)).To(Succeed())
+		return LoadHeaderRules(path)
+	}
+
+	It("applies the rules in order", func() {
+		header := http.Header{
+			"Govuk-Auth-Bypass-Id": {"secret"},
+			"X-Debug":              {"a", "b"},
+			"X-Frame-Options":      {"ALLOWALL"},
+		}
+		applyHeaderRules(header, []HeaderRule{
+			{Op: HeaderOpRemove, Name: "GOVUK-Auth-Bypass-Id"},
+			{Op: HeaderOpRename, Name: "X-Debug", To: "x-internal-debug"},
+			{Op: HeaderOpRename, Name: "X-Missing", To: "X-Other"},
+			{Op: HeaderOpSet, Name: "X-Frame-Options", Value: "DENY"},
+			{Op: HeaderOpAppend, Name: "Vary", Value: "Accept"},
+			{Op: HeaderOpAppend, Name: "Vary", Value: "Cookie"},
+		})
+		Expect(header).To(Equal(http.Header{
+			"X-Internal-Debug": {"a", "b"},
+			"X-Frame-Options":  {"DENY"},
+			"Vary":             {"Accept", "Cookie"},
+		}))
+	})
+
+	It("loads the default rules and the rules for each backend", func() {
+		rules, err := loadRules(`{
+			"default": {"response": [{"op": "remove", "name": "GOVUK-Auth-Bypass-Id"}]},
+			"backends": {"frontend": {"request": [{"op": "set", "name": "X-App", "value": "frontend"}], "response": [{"op": "remove", "name": "X-Debug"}]}}
+		}`)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(rules.ForBackend("frontend")).To(Equal(HeaderRules{
+			Request:  []HeaderRule{{Op: HeaderOpSet, Name: "X-App", Value: "frontend"}},
+			Response: []HeaderRule{{Op: HeaderOpRemove, Name: "GOVUK-Auth-Bypass-Id"}, {Op: HeaderOpRemove, Name: "X-Debug"}},
+		}))
+		Expect(rules.ForBackend("publisher")).To(Equal(HeaderRules{
+			Response: []HeaderRule{{Op: HeaderOpRemove, Name: "GOVUK-Auth-Bypass-Id"}},
+		}))
+	})
+
+	It("has no rules for backends when there are no rules", func() {
+		var rules *HeaderRuleSet
+		Expect(rules.ForBackend("frontend")).To(Equal(HeaderRules{}))
+	})
+
+	DescribeTable("fails to load invalid rules",
+		func(content string) {
+			_, err := loadRules(content)
+			Expect(err).To(HaveOccurred())
+		},
+		Entry("invalid JSON", `{"default": `),
+		Entry("unknown operation", `{"default": {"request": [{"op": "delete", "name": "X-Debug"}]}}`),
+		Entry("empty name", `{"default": {"request": [{"op": "remove"}]}}`),
+		Entry("invalid value", `{"backends": {"frontend": {"response": [{"op": "set", "name": "X-A", "value": "a\r\nSet-Cookie: b"}]}}}`),
+		Entry("rename without a new name", `{"backends": {"frontend": {"response": [{"op": "rename", "name": "X-A"}]}}}`),
+	)
+
+	Context("in backend handlers", func() {
+		var (
+			backend *ghttp.Server
+			rw      *httptest.ResponseRecorder
+		)
+
+		BeforeEach(func() {
+			backend = ghttp.NewServer()
+			backend.AppendHandlers(ghttp.CombineHandlers(
+				ghttp.VerifyHeaderKV("X-App", "frontend"),
+				ghttp.VerifyHeaderKV("X-Route", "browse"),
+				ghttp.RespondWith(http.StatusOK, "", http.Header{
+					"Govuk-Auth-Bypass-Id": {"secret"},
+					"X-Debug":              {"debug"},
+				}),
+			))
+			rw = httptest.NewRecorder()
+
+			BackendHeaderRules = &HeaderRuleSet{
+				Default: HeaderRules{Response: []HeaderRule{{Op: HeaderOpRemove, Name: "GOVUK-Auth-Bypass-Id"}}},
+				Backends: map[string]HeaderRules{
+					"frontend": {Request: []HeaderRule{{Op: HeaderOpSet, Name: "X-App", Value: "frontend"}}},
+				},
+			}
+		})
+
+		AfterEach(func() {
+			BackendHeaderRules = nil
+			backend.Close()
+		})
+
+		It("applies the rules for the backend and then the route", func() {
+			backendURL, err := url.Parse(backend.URL())
+			Expect(err).NotTo(HaveOccurred())
+
+			handler, err := NewHeaderRulesHandler(HeaderRules{
+				Request:  []HeaderRule{{Op: HeaderOpSet, Name: "X-Route", Value: "browse"}},
+				Response: []HeaderRule{{Op: HeaderOpRename, Name: "X-Debug", To: "X-Route-Debug"}},
+			}, NewBackendHandler("frontend", backendURL, time.Second, time.Second, zerolog.Nop()))
+			Expect(err).NotTo(HaveOccurred())
+
+			handler.ServeHTTP(rw, httptest.NewRequest(http.MethodGet, backend.URL()+"/browse", nil))
+			Expect(rw.Code).To(Equal(http.StatusOK))
+			Expect(rw.Header().Values("GOVUK-Auth-Bypass-Id")).To(BeEmpty())
+			Expect(rw.Header().Values("X-Debug")).To(BeEmpty())
+			Expect(rw.Header().Get("X-Route-Debug")).To(Equal("debug"))
+		})
+
+		It("rejects invalid route rules", func() {
+			_, err := NewHeaderRulesHandler(HeaderRules{Request: []HeaderRule{{Op: "delete", Name: "X-Debug"}}}, http.NotFoundHandler())
+			Expect(err).To(HaveOccurred())
+		})
+	})
+})
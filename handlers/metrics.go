@@ -15,6 +15,37 @@ var (
 		},
 	)
 
+	rewriteCountMetric = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "router_rewrite_handler_request_total",
+			Help: "Number of requests passed to backends with a rewritten path by rewrite handlers",
+		},
+		[]string{
+			"backend_id",
+		},
+	)
+
+	staticResponseCountMetric = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "router_static_handler_response_total",
+			Help: "Number of responses served by static handlers, by response type (inline or file)",
+		},
+		[]string{
+			"response_type",
+		},
+	)
+
+	pathNormalisationCountMetric = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "router_path_normalisation_total",
+			Help: "Number of requests whose path wasn't in its canonical form, by issue and the action taken",
+		},
+		[]string{
+			"issue",
+			"action",
+		},
+	)
+
 	backendRequestCountMetric = prometheus.NewCounterVec(
 		prometheus.CounterOpts{
 			Name: "router_backend_handler_request_total",
@@ -35,6 +66,90 @@ var (
 			"backend_id",
 			"request_method",
 			"response_code",
+			"reason",
+		},
+	)
+
+	backendErrorCountMetric = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "router_backend_handler_error_total",
+			Help: "Number of errors encountered by backend handlers, by reason",
+		},
+		[]string{
+			"backend_id",
+			"reason",
+		},
+	)
+
+	staleResponseCountMetric = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "router_backend_handler_stale_response_total",
+			Help: "Number of stale responses served by backend handlers in place of an error",
+		},
+		[]string{
+			"backend_id",
+		},
+	)
+
+	coalescedRequestCountMetric = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "router_backend_handler_coalesced_request_total",
+			Help: "Number of requests served with the response to an identical concurrent request",
+		},
+		[]string{
+			"backend_id",
+		},
+	)
+
+	rateLimitedCountMetric = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "router_rate_limited_request_total",
+			Help: "Number of requests rejected with 429 Too Many Requests by rate limits, by the prefix of the limit",
+		},
+		[]string{
+			"prefix",
+		},
+	)
+
+	shedRequestCountMetric = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "router_backend_handler_shed_request_total",
+			Help: "Number of requests rejected without being sent to backends because too many were in flight, by reason (queue_full, queue_timeout or client_cancelled)",
+		},
+		[]string{
+			"backend_id",
+			"reason",
+		},
+	)
+
+	queueWaitDurationSecondsMetric = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name: "router_backend_handler_queue_wait_duration_seconds",
+			Help: "Histogram of how long requests waited for another request to a backend to finish, when too many were in flight",
+		},
+		[]string{
+			"backend_id",
+		},
+	)
+
+	concurrencyLimitMetric = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "router_backend_handler_concurrency_limit",
+			Help: "Number of requests that can be in flight to a backend, which changes over time for adaptive limits",
+		},
+		[]string{
+			"backend_id",
+		},
+	)
+
+	cacheRequestCountMetric = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "router_backend_handler_cache_request_total",
+			Help: "Number of requests to caching handlers by result (hit, miss or bypass)",
+		},
+		[]string{
+			"backend_id",
+			"result",
 		},
 	)
 )
@@ -43,6 +158,17 @@ func RegisterMetrics(r prometheus.Registerer) {
 	r.MustRegister(
 		backendRequestCountMetric,
 		backendResponseDurationSecondsMetric,
+		backendErrorCountMetric,
+		staleResponseCountMetric,
+		coalescedRequestCountMetric,
+		cacheRequestCountMetric,
+		shedRequestCountMetric,
+		queueWaitDurationSecondsMetric,
+		concurrencyLimitMetric,
 		redirectCountMetric,
+		staticResponseCountMetric,
+		rewriteCountMetric,
+		pathNormalisationCountMetric,
+		rateLimitedCountMetric,
 	)
 }
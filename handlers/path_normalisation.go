@@ -0,0 +1,188 @@
+package handlers
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Path policies say what to do with a request whose path isn't in its
+// canonical form.
+const (
+	// PathPolicyRoute routes the request as it is. This is the default.
+	PathPolicyRoute = "route"
+	// PathPolicyRedirect redirects the request to the canonical path.
+	PathPolicyRedirect = "redirect"
+	// PathPolicyReject responds to the request with 400 Bad Request.
+	PathPolicyReject = "reject"
+)
+
+// PathNormalisation sets the policy for each way in which a request path can
+// differ from its canonical form.
+type PathNormalisation struct {
+	// EncodedUnreserved is for percent-encoded unreserved characters, such
+	// as %7E for ~.
+	EncodedUnreserved string `json:"encoded_unreserved"`
+	// DotSegments is for . and .. segments.
+	DotSegments string `json:"dot_segments"`
+	// DuplicateSlashes is for empty segments, such as in /foo//bar.
+	DuplicateSlashes string `json:"duplicate_slashes"`
+	// TrailingSlash is for paths other than / which end in a slash.
+	TrailingSlash string `json:"trailing_slash"`
+}
+
+type pathRule struct {
+	issue     string
+	policy    string
+	normalise func(string) string
+}
+
+// rules returns the normalisations in the order that they're applied, so that
+// for example a decoded %2E can form a dot segment which is then removed.
+func (n *PathNormalisation) rules() []pathRule {
+	return []pathRule{
+		{"encoded_unreserved", n.EncodedUnreserved, decodeUnreserved},
+		{"dot_segments", n.DotSegments, removeDotSegments},
+		{"duplicate_slashes", n.DuplicateSlashes, collapseSlashes},
+		{"trailing_slash", n.TrailingSlash, trimTrailingSlash},
+	}
+}
+
+func (n *PathNormalisation) validate() error {
+	for _, rule := range n.rules() {
+		switch rule.policy {
+		case "", PathPolicyRoute, PathPolicyRedirect, PathPolicyReject:
+		default:
+			return fmt.Errorf("invalid path_normalisation policy %q for %s", rule.policy, rule.issue)
+		}
+	}
+	return nil
+}
+
+// normalise applies the normalisations whose policy is to redirect to an
+// escaped path. It returns the resulting path and PathPolicyRedirect if any
+// were applied, or PathPolicyReject if the path needs a normalisation whose
+// policy is to reject it. Issues are counted in metrics if count is set.
+func (n *PathNormalisation) normalise(path string, count bool) (string, string) {
+	action := PathPolicyRoute
+	if !strings.HasPrefix(path, "/") {
+		return path, action
+	}
+
+	for _, rule := range n.rules() {
+		normalised := rule.normalise(path)
+		if normalised == path {
+			continue
+		}
+
+		policy := rule.policy
+		if policy == "" {
+			policy = PathPolicyRoute
+		}
+		if count {
+			pathNormalisationCountMetric.WithLabelValues(rule.issue, policy).Inc()
+		}
+
+		switch policy {
+		case PathPolicyReject:
+			return path, PathPolicyReject
+		case PathPolicyRedirect:
+			path = normalised
+			action = PathPolicyRedirect
+		}
+	}
+	return path, action
+}
+
+// decodeUnreserved decodes percent-encoded characters that don't need to be
+// encoded in a path: letters, digits, '-', '.', '_' and '~'.
+func decodeUnreserved(path string) string {
+	if !strings.Contains(path, "%") {
+		return path
+	}
+
+	var b strings.Builder
+	for i := 0; i < len(path); i++ {
+		if path[i] == '%' && i+2 < len(path) {
+			if c, ok := unhex(path[i+1], path[i+2]); ok && isUnreserved(c) {
+				b.WriteByte(c)
+				i += 2
+				continue
+			}
+		}
+		b.WriteByte(path[i])
+	}
+	return b.String()
+}
+
+func unhex(hi, lo byte) (byte, bool) {
+	h, ok1 := hexValue(hi)
+	l, ok2 := hexValue(lo)
+	return h<<4 | l, ok1 && ok2
+}
+
+func hexValue(c byte) (byte, bool) {
+	switch {
+	case '0' <= c && c <= '9':
+		return c - '0', true
+	case 'a' <= c && c <= 'f':
+		return c - 'a' + 10, true
+	case 'A' <= c && c <= 'F':
+		return c - 'A' + 10, true
+	default:
+		return 0, false
+	}
+}
+
+func isUnreserved(c byte) bool {
+	return 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9' ||
+		c == '-' || c == '.' || c == '_' || c == '~'
+}
+
+// removeDotSegments resolves . and .. segments as described in RFC 3986
+// section 5.2.4. It never goes above the root.
+func removeDotSegments(path string) string {
+	if !strings.Contains(path, ".") {
+		return path
+	}
+
+	segments := strings.Split(path, "/")
+	out := make([]string, 0, len(segments))
+	for i, segment := range segments {
+		last := i == len(segments)-1
+		switch segment {
+		case ".":
+		case "..":
+			if len(out) > 1 {
+				out = out[:len(out)-1]
+			}
+		default:
+			out = append(out, segment)
+			continue
+		}
+		// A path ending in a dot segment refers to a directory
+		if last {
+			out = append(out, "")
+		}
+	}
+	return strings.Join(out, "/")
+}
+
+// pathSegments returns the non-empty segments of path, which is how the mux
+// matches paths to routes.
+func pathSegments(path string) []string {
+	return strings.FieldsFunc(path, func(c rune) bool { return c == '/' })
+}
+
+func collapseSlashes(path string) string {
+	for strings.Contains(path, "//") {
+		path = strings.ReplaceAll(path, "//", "/")
+	}
+	return path
+}
+
+func trimTrailingSlash(path string) string {
+	if trimmed := strings.TrimRight(path, "/"); trimmed != "" {
+		return trimmed
+	}
+	return "/"
+}
@@ -0,0 +1,89 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	promtest "github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+var _ = Describe("Path normalisation", func() {
+	DescribeTable("normalising paths",
+		func(normalise func(string) string, path, expected string) {
+			Expect(normalise(path)).To(Equal(expected))
+		},
+		Entry("unreserved characters", decodeUnreserved, "/%7Efoo/%41%62%2d%5F%2E", "/~foo/Ab-_."),
+		Entry("reserved characters", decodeUnreserved, "/foo%2Fbar%20baz%3f", "/foo%2Fbar%20baz%3f"),
+		Entry("invalid escapes", decodeUnreserved, "/foo%zz%4", "/foo%zz%4"),
+		Entry("dot segments", removeDotSegments, "/a/./b/../c", "/a/c"),
+		Entry("trailing dot segment", removeDotSegments, "/a/b/..", "/a/"),
+		Entry("dot segments above the root", removeDotSegments, "/../../a", "/a"),
+		Entry("dots in segments", removeDotSegments, "/a.b/...", "/a.b/..."),
+		Entry("duplicate slashes", collapseSlashes, "//foo///bar//", "/foo/bar/"),
+		Entry("trailing slash", trimTrailingSlash, "/foo/bar//", "/foo/bar"),
+		Entry("root", trimTrailingSlash, "/", "/"),
+	)
+
+	Describe("with canonicalisation rules", func() {
+		var rr *httptest.ResponseRecorder
+
+		BeforeEach(func() {
+			rr = httptest.NewRecorder()
+			Canonical = &CanonicalRules{
+				RedirectCode: http.StatusMovedPermanently,
+				PathNormalisation: PathNormalisation{
+					EncodedUnreserved: PathPolicyRedirect,
+					DotSegments:       PathPolicyReject,
+					DuplicateSlashes:  PathPolicyRedirect,
+					TrailingSlash:     PathPolicyRoute,
+				},
+			}
+		})
+
+		AfterEach(func() {
+			Canonical = nil
+		})
+
+		It("redirects to the canonical path in one step", func() {
+			req := httptest.NewRequest(http.MethodGet, "http://www.gov.uk//foo//%62ar?q=1", nil)
+			Expect(ServeCanonicalRedirect(rr, req)).To(BeTrue())
+			Expect(rr.Code).To(Equal(http.StatusMovedPermanently))
+			Expect(rr.Header().Get("Location")).To(Equal("http://www.gov.uk/foo/bar?q=1"))
+		})
+
+		It("routes paths whose policy is to route them as they are", func() {
+			lbls := []string{"trailing_slash", PathPolicyRoute}
+			before := promtest.ToFloat64(pathNormalisationCountMetric.WithLabelValues(lbls...))
+
+			req := httptest.NewRequest(http.MethodGet, "http://www.gov.uk/foo/", nil)
+			Expect(ServeCanonicalRedirect(rr, req)).To(BeFalse())
+
+			after := promtest.ToFloat64(pathNormalisationCountMetric.WithLabelValues(lbls...))
+			Expect(after - before).To(BeNumerically("~", 1.0))
+		})
+
+		It("rejects paths whose policy is to reject them", func() {
+			req := httptest.NewRequest(http.MethodGet, "http://www.gov.uk/foo/../bar", nil)
+			Expect(ServeCanonicalRedirect(rr, req)).To(BeTrue())
+			Expect(rr.Code).To(Equal(http.StatusBadRequest))
+		})
+
+		It("rejects encoded dot segments when they're decoded", func() {
+			req := httptest.NewRequest(http.MethodGet, "http://www.gov.uk/foo/%2E%2E/bar", nil)
+			Expect(ServeCanonicalRedirect(rr, req)).To(BeTrue())
+			Expect(rr.Code).To(Equal(http.StatusBadRequest))
+		})
+
+		It("doesn't redirect canonical paths", func() {
+			req := httptest.NewRequest(http.MethodGet, "http://www.gov.uk/foo/bar", nil)
+			Expect(ServeCanonicalRedirect(rr, req)).To(BeFalse())
+		})
+	})
+
+	It("fails to load rules with an invalid policy", func() {
+		n := PathNormalisation{TrailingSlash: "strip"}
+		Expect(n.validate()).To(MatchError(ContainSubstring("trailing_slash")))
+	})
+})
@@ -0,0 +1,229 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// rateLimitSweepInterval is how often buckets which have refilled are
+// removed, so that clients which have stopped making requests don't use
+// memory.
+const rateLimitSweepInterval = time.Minute
+
+// rateLimitMaxBuckets is the most clients that a limit keeps buckets for, so
+// that requests from many addresses can't use unbounded memory. New clients
+// are rejected while a limit has this many buckets which haven't refilled.
+const rateLimitMaxBuckets = 100_000
+
+// RateLimit limits the rate of requests for paths under a prefix from each
+// client, using a token bucket.
+type RateLimit struct {
+	// Prefix is the path prefix that the limit applies to, matched by path
+	// segment like a prefix route. Requests use the limit with the longest
+	// matching prefix.
+	Prefix string `json:"prefix"`
+	// RequestsPerSecond is the rate that each client's bucket refills at.
+	RequestsPerSecond float64 `json:"requests_per_second"`
+	// Burst is the size of each client's bucket, which defaults to
+	// RequestsPerSecond rounded up.
+	Burst int `json:"burst"`
+	// KeyHeader identifies clients by the value of a request header, such as
+	// an API key, rather than by their IP address. Requests without the
+	// header, or with a value that isn't one of Keys, are identified by IP
+	// address.
+	KeyHeader string `json:"key_header"`
+	// Keys are the values of KeyHeader that identify clients, so that clients
+	// can't get a new bucket by making up a value.
+	Keys []string `json:"keys"`
+}
+
+// RateLimitRules configures the rate limits that Router applies before
+// looking up a route.
+type RateLimitRules struct {
+	Limits []RateLimit `json:"limits"`
+
+	limiters []*rateLimiter
+}
+
+// RateLimits holds the rate limits, or nil if there are none.
+var RateLimits *RateLimitRules
+
+// LoadRateLimits reads rate limits from a JSON file.
+func LoadRateLimits(path string) (*RateLimitRules, error) {
+	data, err := os.ReadFile(path) //nolint:gosec // path is from ROUTER_RATE_LIMITS_FILE env var, controlled by user
+	if err != nil {
+		return nil, fmt.Errorf("failed to read rate limits: %w", err)
+	}
+
+	limits := &RateLimitRules{}
+	if err := json.Unmarshal(data, limits); err != nil {
+		return nil, fmt.Errorf("failed to parse rate limits: %w", err)
+	}
+	if err := limits.init(); err != nil {
+		return nil, err
+	}
+	return limits, nil
+}
+
+// init validates the limits and creates their buckets.
+func (limits *RateLimitRules) init() error {
+	limits.limiters = nil
+	for _, limit := range limits.Limits {
+		if !strings.HasPrefix(limit.Prefix, "/") {
+			return fmt.Errorf("invalid rate limit prefix %q", limit.Prefix)
+		}
+		if limit.RequestsPerSecond <= 0 || limit.Burst < 0 {
+			return fmt.Errorf("invalid rate limit for %s", limit.Prefix)
+		}
+		if limit.KeyHeader != "" && !validHeaderName(limit.KeyHeader) {
+			return fmt.Errorf("invalid rate limit key_header %q for %s", limit.KeyHeader, limit.Prefix)
+		}
+		if (limit.KeyHeader == "") != (len(limit.Keys) == 0) {
+			return fmt.Errorf("rate limit for %s needs both key_header and keys, or neither", limit.Prefix)
+		}
+		if limit.Burst == 0 {
+			limit.Burst = int(math.Ceil(limit.RequestsPerSecond))
+		}
+		keys := make(map[string]bool, len(limit.Keys))
+		for _, key := range limit.Keys {
+			if key == "" {
+				return fmt.Errorf("empty rate limit key for %s", limit.Prefix)
+			}
+			keys[key] = true
+		}
+		segments := pathSegments(limit.Prefix)
+		limit.Prefix = "/" + strings.Join(segments, "/")
+		limits.limiters = append(limits.limiters, &rateLimiter{
+			limit:      limit,
+			segments:   segments,
+			keys:       keys,
+			buckets:    map[string]*tokenBucket{},
+			maxBuckets: rateLimitMaxBuckets,
+		})
+	}
+
+	// Check the longest prefixes first
+	slices.SortStableFunc(limits.limiters, func(a, b *rateLimiter) int {
+		return len(b.segments) - len(a.segments)
+	})
+	return nil
+}
+
+// limiterFor returns the limiter for path, or nil if path isn't limited. Like
+// the mux, it ignores empty path segments.
+func (limits *RateLimitRules) limiterFor(path string) *rateLimiter {
+	segments := pathSegments(path)
+	for _, limiter := range limits.limiters {
+		if len(segments) >= len(limiter.segments) && slices.Equal(segments[:len(limiter.segments)], limiter.segments) {
+			return limiter
+		}
+	}
+	return nil
+}
+
+// ServeRateLimited responds to r with 429 Too Many Requests if its client has
+// made too many requests for its path, according to the limits in
+// RateLimits. It reports whether it responded to r.
+func ServeRateLimited(w http.ResponseWriter, r *http.Request) bool {
+	if RateLimits == nil {
+		return false
+	}
+	limiter := RateLimits.limiterFor(r.URL.Path)
+	if limiter == nil {
+		return false
+	}
+
+	var key string
+	if value := r.Header.Get(limiter.limit.KeyHeader); limiter.keys[value] {
+		key = "header " + value
+	} else {
+		key = "ip " + clientIP(r)
+	}
+
+	wait, ok := limiter.take(key, time.Now())
+	if ok {
+		return false
+	}
+
+	rateLimitedCountMetric.With(prometheus.Labels{"prefix": limiter.limit.Prefix}).Inc()
+	w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+	if !ServeErrorPage(w, r, http.StatusTooManyRequests) {
+		http.Error(w, "429 Too Many Requests", http.StatusTooManyRequests)
+	}
+	return true
+}
+
+type rateLimiter struct {
+	limit    RateLimit
+	segments []string
+	keys     map[string]bool
+
+	mu         sync.Mutex
+	buckets    map[string]*tokenBucket
+	maxBuckets int
+	lastSweep  time.Time
+}
+
+type tokenBucket struct {
+	tokens  float64
+	updated time.Time
+}
+
+// take takes a token from the bucket for key at now. If the bucket is empty,
+// it returns how long until it has a token and false.
+func (limiter *rateLimiter) take(key string, now time.Time) (time.Duration, bool) {
+	limiter.mu.Lock()
+	defer limiter.mu.Unlock()
+
+	if now.Sub(limiter.lastSweep) >= rateLimitSweepInterval {
+		limiter.sweep(now)
+	}
+
+	bucket, ok := limiter.buckets[key]
+	if !ok {
+		if len(limiter.buckets) >= limiter.maxBuckets && now.Sub(limiter.lastSweep) >= time.Second {
+			limiter.sweep(now)
+		}
+		if len(limiter.buckets) >= limiter.maxBuckets {
+			return max(time.Duration(float64(time.Second)/limiter.limit.RequestsPerSecond), time.Second), false
+		}
+		bucket = &tokenBucket{tokens: float64(limiter.limit.Burst), updated: now}
+		limiter.buckets[key] = bucket
+	}
+	bucket.tokens = limiter.refill(bucket, now)
+	bucket.updated = now
+
+	if bucket.tokens < 1 {
+		wait := time.Duration((1 - bucket.tokens) / limiter.limit.RequestsPerSecond * float64(time.Second))
+		return max(wait, time.Second), false
+	}
+	bucket.tokens--
+	return 0, true
+}
+
+// refill returns the number of tokens in bucket at now.
+func (limiter *rateLimiter) refill(bucket *tokenBucket, now time.Time) float64 {
+	elapsed := now.Sub(bucket.updated).Seconds()
+	return min(float64(limiter.limit.Burst), bucket.tokens+elapsed*limiter.limit.RequestsPerSecond)
+}
+
+// sweep removes the buckets which are full at now, as they're the same as
+// new buckets.
+func (limiter *rateLimiter) sweep(now time.Time) {
+	for key, bucket := range limiter.buckets {
+		if limiter.refill(bucket, now) >= float64(limiter.limit.Burst) {
+			delete(limiter.buckets, key)
+		}
+	}
+	limiter.lastSweep = now
+}
@@ -0,0 +1,141 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/prometheus/client_golang/prometheus"
+	promtest "github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+var _ = Describe("Rate limits", func() {
+	load := func(content string) (*RateLimitRules, error) {
+		path := filepath.Join(GinkgoT().TempDir(), "rate-limits.json")
+		Expect(os.WriteFile(path, []byte(content), 0o600)).To(Succeed())
+		return LoadRateLimits(path)
+	}
+
+	serve := func(path, remoteAddr string, header http.Header) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.RemoteAddr = remoteAddr
+		for name, values := range header {
+			req.Header[name] = values
+		}
+		rr := httptest.NewRecorder()
+		if !ServeRateLimited(rr, req) {
+			rr.WriteHeader(http.StatusOK)
+		}
+		return rr
+	}
+
+	BeforeEach(func() {
+		var err error
+		RateLimits, err = load(`{"limits": [
+			{"prefix": "/search", "requests_per_second": 0.1, "burst": 2},
+			{"prefix": "/search/api/", "requests_per_second": 0.1, "burst": 1, "key_header": "X-Api-Key", "keys": ["key-1", "key-2"]}
+		]}`)
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		RateLimits = nil
+	})
+
+	It("limits each client to a burst of requests", func() {
+		lbls := prometheus.Labels{"prefix": "/search"}
+		before := promtest.ToFloat64(rateLimitedCountMetric.With(lbls))
+
+		Expect(serve("/search/all", "192.0.2.1:1234", nil).Code).To(Equal(http.StatusOK))
+		Expect(serve("/search", "192.0.2.1:1234", nil).Code).To(Equal(http.StatusOK))
+		rr := serve("/search/all", "192.0.2.1:5678", nil)
+		Expect(rr.Code).To(Equal(http.StatusTooManyRequests))
+		Expect(rr.Header().Get("Retry-After")).To(Equal("10"))
+
+		Expect(serve("/search/all", "192.0.2.2:1234", nil).Code).To(Equal(http.StatusOK))
+		Expect(promtest.ToFloat64(rateLimitedCountMetric.With(lbls)) - before).To(BeNumerically("~", 1.0))
+	})
+
+	It("matches prefixes by path segment like the mux", func() {
+		Expect(serve("//search//all", "192.0.2.1:1234", nil).Code).To(Equal(http.StatusOK))
+		Expect(serve("/search/", "192.0.2.1:1234", nil).Code).To(Equal(http.StatusOK))
+		Expect(serve("/search", "192.0.2.1:1234", nil).Code).To(Equal(http.StatusTooManyRequests))
+		Expect(RateLimits.limiterFor("/search//api/").limit.Prefix).To(Equal("/search/api"))
+	})
+
+	It("doesn't limit paths without a limit", func() {
+		for range 5 {
+			Expect(serve("/searching", "192.0.2.1:1234", nil).Code).To(Equal(http.StatusOK))
+			Expect(serve("/", "192.0.2.1:1234", nil).Code).To(Equal(http.StatusOK))
+		}
+	})
+
+	It("uses the limit with the longest prefix, keyed on its header", func() {
+		key := http.Header{"X-Api-Key": {"key-1"}}
+		Expect(serve("/search/api/postcode", "192.0.2.1:1234", key).Code).To(Equal(http.StatusOK))
+		Expect(serve("/search/api/postcode", "192.0.2.2:1234", key).Code).To(Equal(http.StatusTooManyRequests))
+		Expect(serve("/search/api/postcode", "192.0.2.2:1234", http.Header{"X-Api-Key": {"key-2"}}).Code).To(Equal(http.StatusOK))
+		Expect(serve("/search/api/postcode", "192.0.2.2:1234", nil).Code).To(Equal(http.StatusOK))
+	})
+
+	It("identifies clients with unknown keys by IP address", func() {
+		Expect(serve("/search/api/postcode", "192.0.2.1:1234", http.Header{"X-Api-Key": {"made-up-1"}}).Code).To(Equal(http.StatusOK))
+		Expect(serve("/search/api/postcode", "192.0.2.1:1234", http.Header{"X-Api-Key": {"made-up-2"}}).Code).To(Equal(http.StatusTooManyRequests))
+	})
+
+	It("ignores X-Forwarded-For from clients which aren't trusted proxies", func() {
+		for i := range 2 {
+			Expect(serve("/search", "192.0.2.1:1234", http.Header{"X-Forwarded-For": {fmt.Sprintf("198.51.100.%d", i)}}).Code).To(Equal(http.StatusOK))
+		}
+		Expect(serve("/search", "192.0.2.1:1234", http.Header{"X-Forwarded-For": {"198.51.100.9"}}).Code).To(Equal(http.StatusTooManyRequests))
+	})
+
+	It("rejects new clients while it has too many buckets", func() {
+		limiter := RateLimits.limiterFor("/search")
+		limiter.maxBuckets = 1
+		now := time.Now()
+		_, ok := limiter.take("ip 192.0.2.1", now)
+		Expect(ok).To(BeTrue())
+		_, ok = limiter.take("ip 192.0.2.2", now)
+		Expect(ok).To(BeFalse())
+
+		_, ok = limiter.take("ip 192.0.2.2", now.Add(20*time.Second))
+		Expect(ok).To(BeTrue())
+	})
+
+	It("refills buckets over time and forgets full ones", func() {
+		limiter := RateLimits.limiterFor("/search")
+		now := time.Now()
+		for range 2 {
+			_, ok := limiter.take("ip 192.0.2.1", now)
+			Expect(ok).To(BeTrue())
+		}
+		wait, ok := limiter.take("ip 192.0.2.1", now)
+		Expect(ok).To(BeFalse())
+		Expect(wait).To(Equal(10 * time.Second))
+
+		_, ok = limiter.take("ip 192.0.2.1", now.Add(10*time.Second))
+		Expect(ok).To(BeTrue())
+
+		limiter.sweep(now.Add(time.Hour))
+		Expect(limiter.buckets).To(BeEmpty())
+	})
+
+	DescribeTable("rejects invalid limits",
+		func(content string) {
+			_, err := load(content)
+			Expect(err).To(HaveOccurred())
+		},
+		Entry("relative prefix", `{"limits": [{"prefix": "search", "requests_per_second": 1}]}`),
+		Entry("no rate", `{"limits": [{"prefix": "/search"}]}`),
+		Entry("negative burst", `{"limits": [{"prefix": "/search", "requests_per_second": 1, "burst": -1}]}`),
+		Entry("invalid key header", `{"limits": [{"prefix": "/search", "requests_per_second": 1, "key_header": "X Api Key", "keys": ["key-1"]}]}`),
+		Entry("key header without keys", `{"limits": [{"prefix": "/search", "requests_per_second": 1, "key_header": "X-Api-Key"}]}`),
+		Entry("empty key", `{"limits": [{"prefix": "/search", "requests_per_second": 1, "key_header": "X-Api-Key", "keys": [""]}]}`),
+	)
+})
@@ -3,7 +3,6 @@ package handlers
 import (
 	"fmt"
 	"net/http"
-	"net/url"
 	"strings"
 	"time"
 
@@ -12,54 +11,67 @@ import (
 	"github.com/rs/zerolog"
 )
 
-const (
-	cacheDuration = 30 * time.Minute
+// RedirectCacheDuration is how long responses from redirect handlers may be
+// cached for, unless a route sets its own duration. Zero means that they must
+// not be cached at all.
+var RedirectCacheDuration = 30 * time.Minute
 
+const (
 	redirectHandlerType               = "redirect-handler"
 	pathPreservingRedirectHandlerType = "path-preserving-redirect-handler"
 	downcaseRedirectHandlerType       = "downcase-redirect-handler"
 )
 
-func NewRedirectHandler(source, target string, preserve bool, logger zerolog.Logger) http.Handler {
-	status := http.StatusMovedPermanently
+// IsRedirectCode reports whether code is one of the HTTP status codes that
+// redirect handlers can respond with.
+func IsRedirectCode(code int) bool {
+	switch code {
+	case http.StatusMovedPermanently, http.StatusFound, http.StatusSeeOther,
+		http.StatusTemporaryRedirect, http.StatusPermanentRedirect:
+		return true
+	default:
+		return false
+	}
+}
+
+// NewRedirectHandler returns a handler that redirects requests to target. If
+// preserve is set, the part of the request path after source is appended to
+// target. The queryPolicy controls what happens to the query string of the
+// request; if it's empty, DefaultQueryPolicy is used.
+func NewRedirectHandler(source, target string, preserve bool, code int, cacheDuration time.Duration, queryPolicy string, logger zerolog.Logger) http.Handler {
+	if queryPolicy == "" {
+		queryPolicy = DefaultQueryPolicy(preserve)
+	}
 	// Preserve the URL path and append it to the target prefix
 	if preserve {
-		return &pathPreservingRedirectHandler{source, target, status, logger}
+		return &pathPreservingRedirectHandler{source, target, code, cacheDuration, queryPolicy, logger}
 	}
-	return &redirectHandler{target, status, logger}
+	return &redirectHandler{target, code, cacheDuration, queryPolicy, logger}
 }
 
-func addCacheHeaders(w http.ResponseWriter) {
+func addCacheHeaders(w http.ResponseWriter, cacheDuration time.Duration) {
+	if cacheDuration <= 0 {
+		w.Header().Set("Cache-Control", "no-store")
+		return
+	}
 	w.Header().Set("Expires", time.Now().Add(cacheDuration).Format(time.RFC1123))
 	w.Header().Set("Cache-Control", fmt.Sprintf("max-age=%d, public", cacheDuration/time.Second))
 }
 
-func addGAQueryParam(target string, r *http.Request) (string, error) {
-	if ga := r.URL.Query().Get("_ga"); ga != "" {
-		u, err := url.Parse(target)
-		if err != nil {
-			return target, err
-		}
-		values := u.Query()
-		values.Set("_ga", ga)
-		u.RawQuery = values.Encode()
-		return u.String(), nil
-	}
-	return target, nil
-}
-
 type redirectHandler struct {
-	url    string
-	code   int
-	logger zerolog.Logger
+	url           string
+	code          int
+	cacheDuration time.Duration
+	queryPolicy   string
+	logger        zerolog.Logger
 }
 
 func (handler *redirectHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	addCacheHeaders(w)
+	addCacheHeaders(w, handler.cacheDuration)
 
-	target, err := addGAQueryParam(handler.url, r)
+	target, err := redirectLocation(handler.url, "", r.URL.RawQuery, handler.queryPolicy)
 	if err != nil {
-		handler.logger.Error().Err(err).Msg("failed to add GA query param")
+		handler.logger.Warn().Err(err).Str("request_id", RequestID(r.Context())).Msg("failed to parse query string of redirected request")
 	}
 
 	http.Redirect(w, r, target, handler.code)
@@ -70,19 +82,22 @@ func (handler *redirectHandler) ServeHTTP(w http.ResponseWriter, r *http.Request
 }
 
 type pathPreservingRedirectHandler struct {
-	sourcePrefix string
-	targetPrefix string
-	code         int
-	logger       zerolog.Logger
+	sourcePrefix  string
+	targetPrefix  string
+	code          int
+	cacheDuration time.Duration
+	queryPolicy   string
+	logger        zerolog.Logger
 }
 
 func (handler *pathPreservingRedirectHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	target := handler.targetPrefix + strings.TrimPrefix(r.URL.Path, handler.sourcePrefix)
-	if r.URL.RawQuery != "" {
-		target += "?" + r.URL.RawQuery
+	suffix := strings.TrimPrefix(r.URL.Path, handler.sourcePrefix)
+	target, err := redirectLocation(handler.targetPrefix, suffix, r.URL.RawQuery, handler.queryPolicy)
+	if err != nil {
+		handler.logger.Warn().Err(err).Str("request_id", RequestID(r.Context())).Msg("failed to parse query string of redirected request")
 	}
 
-	addCacheHeaders(w)
+	addCacheHeaders(w, handler.cacheDuration)
 	http.Redirect(w, r, target, handler.code)
 
 	redirectCountMetric.With(prometheus.Labels{
@@ -104,7 +119,7 @@ func (handler *downcaseRedirectHandler) ServeHTTP(w http.ResponseWriter, r *http
 		target += "?" + r.URL.RawQuery
 	}
 
-	addCacheHeaders(w)
+	addCacheHeaders(w, RedirectCacheDuration)
 	http.Redirect(w, r, target, status)
 
 	redirectCountMetric.With(prometheus.Labels{
@@ -30,7 +30,7 @@ var _ = Describe("A redirect handler", func() {
 	for _, preserve := range []bool{true, false} {
 		Context(fmt.Sprintf("where preserve=%t", preserve), func() {
 			BeforeEach(func() {
-				handler = NewRedirectHandler("/source", "/target", preserve, logger)
+				handler = NewRedirectHandler("/source", "/target", preserve, http.StatusMovedPermanently, 30*time.Minute, "", logger)
 				handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, url, nil))
 			})
 
@@ -51,9 +51,21 @@ var _ = Describe("A redirect handler", func() {
 		})
 	}
 
+	Context("with a cache duration of zero", func() {
+		BeforeEach(func() {
+			handler = NewRedirectHandler("/source", "/target", false, http.StatusFound, 0, "", logger)
+			handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, url, nil))
+		})
+
+		It("does not allow its response to be cached", func() {
+			Expect(rr.Result().Header.Get("Cache-Control")).To(Equal("no-store"))
+			Expect(rr.Result().Header.Get("Expires")).To(BeEmpty())
+		})
+	})
+
 	Context("where preserve=true", func() {
 		BeforeEach(func() {
-			handler = NewRedirectHandler("/source", "/target", true, logger)
+			handler = NewRedirectHandler("/source", "/target", true, http.StatusMovedPermanently, 30*time.Minute, "", logger)
 			handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, url, nil))
 		})
 
@@ -64,7 +76,7 @@ var _ = Describe("A redirect handler", func() {
 
 	Context("where preserve=false", func() {
 		BeforeEach(func() {
-			handler = NewRedirectHandler("/source", "/target", false, logger)
+			handler = NewRedirectHandler("/source", "/target", false, http.StatusMovedPermanently, 30*time.Minute, "", logger)
 		})
 
 		It("returns only the configured path in the location header", func() {
@@ -79,16 +91,76 @@ var _ = Describe("A redirect handler", func() {
 		})
 	})
 
+	DescribeTable("applies the query policy to the location header",
+		EntryDescription("target=%q, preserve=%t, policy=%q, query=%q -> %q"),
+		Entry(nil, "/target", false, QueryPolicyDrop, "_ga=1&q=a", "/target"),
+		Entry(nil, "/target", true, QueryPolicyDrop, "_ga=1&q=a", "/target/path"),
+		Entry(nil, "/target", false, QueryPolicyPreserve, "q=a&_ga=1", "/target?q=a&_ga=1"),
+		Entry(nil, "/target?t=1", false, QueryPolicyPreserve, "q=a", "/target?t=1&q=a"),
+		Entry(nil, "/target?t=1#top", true, QueryPolicyPreserve, "q=a", "/target/path?t=1&q=a#top"),
+		Entry(nil, "/target", true, QueryPolicyAllowlist, "_ga=1&q=a", "/target/path?_ga=1"),
+		Entry(nil, "/target?_ga=0&t=1", false, QueryPolicyAllowlist, "_ga=1&q=a", "/target?t=1&_ga=1"),
+		Entry(nil, "/target?t=1;x", false, QueryPolicyAllowlist, "q=a", "/target?t=1;x"),
+		Entry(nil, "/target?t=1;x", false, QueryPolicyAllowlist, "_ga=1", "/target?t=1;x&_ga=1"),
+		Entry(nil, "/target#top", false, QueryPolicyAllowlist, "_ga=1", "/target?_ga=1#top"),
+		Entry(nil, "/target?t=1&q=b", false, QueryPolicyMerge, "q=a&r=c", "/target?t=1&q=a&r=c"),
+		Entry(nil, "/target?b=%zz", false, QueryPolicyMerge, "q=a", "/target?b=%zz&q=a"),
+		Entry(nil, "/target?t=1#top", false, QueryPolicyMerge, "", "/target?t=1#top"),
+		func(target string, preserve bool, policy, query, expectedLocation string) {
+			handler = NewRedirectHandler("/source", target, preserve, http.StatusMovedPermanently, 30*time.Minute, policy, logger)
+			handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "https://source.example.com/source/path?"+query, nil))
+			Expect(rr.Result().Header.Get("Location")).To(Equal(expectedLocation))
+		})
+
+	It("preserves the parameters in RedirectQueryAllowlist", func() {
+		defer func(allowlist []string) { RedirectQueryAllowlist = allowlist }(RedirectQueryAllowlist)
+		RedirectQueryAllowlist = []string{"utm_source", "utm_medium"}
+
+		handler = NewRedirectHandler("/source", "/target", false, http.StatusMovedPermanently, 30*time.Minute, "", logger)
+		handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet,
+			"https://source.example.com/source?_ga=1&utm_source=a&utm_medium=b&q=c", nil))
+		Expect(rr.Result().Header.Get("Location")).To(Equal("/target?utm_medium=b&utm_source=a"))
+	})
+
+	DescribeTable("IsQueryPolicy",
+		func(policy string, expected bool) {
+			Expect(IsQueryPolicy(policy)).To(Equal(expected))
+		},
+		Entry("default", "", true),
+		Entry("drop", QueryPolicyDrop, true),
+		Entry("preserve", QueryPolicyPreserve, true),
+		Entry("allowlist", QueryPolicyAllowlist, true),
+		Entry("merge", QueryPolicyMerge, true),
+		Entry("unknown", "keep", false),
+	)
+
 	DescribeTable("responds with the right HTTP status",
-		EntryDescription("preserve=%t -> HTTP %d"),
-		Entry(nil, false, http.StatusMovedPermanently),
-		Entry(nil, true, http.StatusMovedPermanently),
-		func(preserve bool, expectedStatus int) {
-			handler = NewRedirectHandler("/source", "/target", preserve, logger)
+		EntryDescription("preserve=%t, code=%d -> HTTP %d"),
+		Entry(nil, false, http.StatusMovedPermanently, http.StatusMovedPermanently),
+		Entry(nil, true, http.StatusMovedPermanently, http.StatusMovedPermanently),
+		Entry(nil, false, http.StatusFound, http.StatusFound),
+		Entry(nil, true, http.StatusSeeOther, http.StatusSeeOther),
+		Entry(nil, false, http.StatusTemporaryRedirect, http.StatusTemporaryRedirect),
+		Entry(nil, true, http.StatusPermanentRedirect, http.StatusPermanentRedirect),
+		func(preserve bool, code int, expectedStatus int) {
+			handler = NewRedirectHandler("/source", "/target", preserve, code, 30*time.Minute, "", logger)
 			handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, url, nil))
 			Expect(rr.Result().StatusCode).To(Equal(expectedStatus))
 		})
 
+	DescribeTable("IsRedirectCode",
+		func(code int, expected bool) {
+			Expect(IsRedirectCode(code)).To(Equal(expected))
+		},
+		Entry("301", http.StatusMovedPermanently, true),
+		Entry("302", http.StatusFound, true),
+		Entry("303", http.StatusSeeOther, true),
+		Entry("307", http.StatusTemporaryRedirect, true),
+		Entry("308", http.StatusPermanentRedirect, true),
+		Entry("200", http.StatusOK, false),
+		Entry("304", http.StatusNotModified, false),
+	)
+
 	DescribeTable("increments the redirect-count metric with the right labels",
 		EntryDescription("preserve=%t -> {redirect_type=%s}"),
 		Entry(nil, false, "redirect-handler"),
@@ -99,7 +171,7 @@ var _ = Describe("A redirect handler", func() {
 			lbls := prometheus.Labels{"redirect_type": typeLabel}
 			before := promtest.ToFloat64(redirectCountMetric.With(lbls))
 
-			handler = NewRedirectHandler("/source", "/target", preserve, logger)
+			handler = NewRedirectHandler("/source", "/target", preserve, http.StatusMovedPermanently, 30*time.Minute, "", logger)
 			handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, url, nil))
 
 			after := promtest.ToFloat64(redirectCountMetric.With(lbls))
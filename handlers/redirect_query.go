@@ -0,0 +1,121 @@
+package handlers
+
+import (
+	"maps"
+	"net/url"
+	"slices"
+	"strings"
+)
+
+// Query policies control what happens to the query string of a request when
+// it is redirected.
+const (
+	// QueryPolicyDrop discards the query string of the request.
+	QueryPolicyDrop = "drop"
+	// QueryPolicyPreserve appends the whole query string of the request to
+	// the target, after any query string that the target already has.
+	QueryPolicyPreserve = "preserve"
+	// QueryPolicyAllowlist carries over only the parameters listed in
+	// RedirectQueryAllowlist, replacing any of the same name in the target.
+	QueryPolicyAllowlist = "allowlist"
+	// QueryPolicyMerge combines the parameters of the request with those of
+	// the target, with the request's values taking precedence.
+	QueryPolicyMerge = "merge"
+)
+
+// RedirectQueryAllowlist is the set of query parameters (typically analytics
+// parameters such as _ga) that redirects using QueryPolicyAllowlist carry over
+// to their target.
+var RedirectQueryAllowlist = []string{"_ga"}
+
+// IsQueryPolicy reports whether policy is a query policy that redirect
+// handlers understand. The empty string selects the handler's default.
+func IsQueryPolicy(policy string) bool {
+	switch policy {
+	case "", QueryPolicyDrop, QueryPolicyPreserve, QueryPolicyAllowlist, QueryPolicyMerge:
+		return true
+	default:
+		return false
+	}
+}
+
+// DefaultQueryPolicy returns the query policy of redirects which don't set
+// one: redirects that preserve the path keep the whole query string and other
+// redirects keep only allowlisted parameters.
+func DefaultQueryPolicy(preserve bool) string {
+	if preserve {
+		return QueryPolicyPreserve
+	}
+	return QueryPolicyAllowlist
+}
+
+// redirectLocation builds the location for a redirect to target, with suffix
+// appended to its path and its query string combined with rawQuery according
+// to policy. A fragment in target is kept at the end of the location.
+func redirectLocation(target, suffix, rawQuery, policy string) (string, error) {
+	location, fragment, hasFragment := strings.Cut(target, "#")
+	location, targetQuery, _ := strings.Cut(location, "?")
+	location += suffix
+
+	query, err := combineQuery(targetQuery, rawQuery, policy)
+	if query != "" {
+		location += "?" + query
+	}
+	if hasFragment {
+		location += "#" + fragment
+	}
+	return location, err
+}
+
+// combineQuery returns the query string for a redirect whose target has
+// targetQuery, for a request with rawQuery. The target's parameters are kept
+// as they are written, apart from any replaced by parameters of the request.
+// Malformed parameters in the request are skipped and reported in the error.
+func combineQuery(targetQuery, rawQuery, policy string) (string, error) {
+	if rawQuery == "" {
+		return targetQuery, nil
+	}
+
+	switch policy {
+	case QueryPolicyPreserve:
+		if targetQuery == "" {
+			return rawQuery, nil
+		}
+		return targetQuery + "&" + rawQuery, nil
+	case QueryPolicyAllowlist, QueryPolicyMerge:
+		requestValues, err := url.ParseQuery(rawQuery)
+		if policy == QueryPolicyAllowlist {
+			maps.DeleteFunc(requestValues, func(key string, _ []string) bool {
+				return !slices.Contains(RedirectQueryAllowlist, key)
+			})
+		}
+		if len(requestValues) == 0 {
+			return targetQuery, err
+		}
+
+		// The target's parameters are kept as they were written, since they
+		// may not be ones that url.ParseQuery would accept and re-encode.
+		query := requestValues.Encode()
+		if kept := withoutParams(targetQuery, requestValues); kept != "" {
+			query = kept + "&" + query
+		}
+		return query, err
+	default:
+		return targetQuery, nil
+	}
+}
+
+// withoutParams returns query without the parameters named in values.
+func withoutParams(query string, values url.Values) string {
+	var kept []string
+	for param := range strings.SplitSeq(query, "&") {
+		name, _, _ := strings.Cut(param, "=")
+		if key, err := url.QueryUnescape(name); err == nil {
+			name = key
+		}
+		if param != "" && !values.Has(name) {
+			kept = append(kept, param)
+		}
+	}
+	return strings.Join(kept, "&")
+}
@@ -0,0 +1,68 @@
+package handlers
+
+import (
+	"context"
+	"crypto/rand"
+	"net/http"
+)
+
+// RequestIDHeader is the header that request IDs are read from, forwarded to
+// backends in and returned to clients in.
+const RequestIDHeader = "GOVUK-Request-Id"
+
+// requestIDHeaders are the headers that a trusted request ID is read from, in
+// order of preference.
+var requestIDHeaders = []string{RequestIDHeader, "X-Request-Id"}
+
+const maxRequestIDLength = 200
+
+// TrustRequestID makes Router use the request ID from the GOVUK-Request-Id or
+// X-Request-Id header of incoming requests sent by trusted proxies, rather
+// than always generating a new one. Only set it when Router is behind a proxy
+// which sets or strips these headers.
+var TrustRequestID bool
+
+type requestIDKey struct{}
+
+// WithRequestID returns r with a request ID in its context, and sets the
+// request ID header on the response. The ID is taken from r if TrustRequestID
+// is set, r was sent by a trusted proxy and it has a valid one, otherwise a
+// new one is generated.
+func WithRequestID(w http.ResponseWriter, r *http.Request) *http.Request {
+	id := ""
+	if TrustRequestID && trustedPeer(r) {
+		for _, header := range requestIDHeaders {
+			if candidate := r.Header.Get(header); validRequestID(candidate) {
+				id = candidate
+				break
+			}
+		}
+	}
+	if id == "" {
+		id = rand.Text()
+	}
+
+	w.Header().Set(RequestIDHeader, id)
+	return r.WithContext(context.WithValue(r.Context(), requestIDKey{}, id))
+}
+
+// RequestID returns the request ID in ctx, or the empty string if there
+// isn't one.
+func RequestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// validRequestID reports whether id is short and only has visible ASCII
+// characters, so it's safe to log and to send in headers.
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] <= ' ' || id[i] > '~' {
+			return false
+		}
+	}
+	return true
+}
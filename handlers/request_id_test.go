@@ -0,0 +1,91 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/onsi/gomega/ghttp"
+	"github.com/rs/zerolog"
+)
+
+var _ = Describe("Request IDs", func() {
+	var (
+		rr  *httptest.ResponseRecorder
+		req *http.Request
+	)
+
+	BeforeEach(func() {
+		rr = httptest.NewRecorder()
+		req = httptest.NewRequest(http.MethodGet, "/foo", nil)
+	})
+
+	AfterEach(func() {
+		TrustRequestID = false
+	})
+
+	It("generates a request ID", func() {
+		id := RequestID(WithRequestID(rr, req).Context())
+		Expect(id).NotTo(BeEmpty())
+		Expect(rr.Header().Get(RequestIDHeader)).To(Equal(id))
+		Expect(RequestID(WithRequestID(rr, req).Context())).NotTo(Equal(id))
+	})
+
+	It("ignores the request ID from the request by default", func() {
+		req.Header.Set(RequestIDHeader, "client-id")
+		Expect(RequestID(WithRequestID(rr, req).Context())).NotTo(Equal("client-id"))
+	})
+
+	DescribeTable("uses a trusted request ID from the request",
+		func(header, value string, expectTrusted bool) {
+			TrustRequestID = true
+			req.Header.Set(header, value)
+			id := RequestID(WithRequestID(rr, req).Context())
+			if expectTrusted {
+				Expect(id).To(Equal(value))
+			} else {
+				Expect(id).NotTo(Equal(value))
+				Expect(id).NotTo(BeEmpty())
+			}
+		},
+		Entry("GOVUK-Request-Id", "GOVUK-Request-Id", "1234-5678", true),
+		Entry("X-Request-Id", "X-Request-Id", "abcd-efgh", true),
+		Entry("with a space", "GOVUK-Request-Id", "1234 5678", false),
+		Entry("too long", "X-Request-Id", strings.Repeat("a", maxRequestIDLength+1), false),
+	)
+
+	It("forwards the request ID to backends and replaces the one from the backend", func() {
+		backend := ghttp.NewServer()
+		defer backend.Close()
+		backend.AppendHandlers(ghttp.CombineHandlers(
+			ghttp.VerifyHeaderKV("GOVUK-Request-Id", "1234-5678"),
+			ghttp.VerifyHeaderKV("X-Request-Id", "1234-5678"),
+			ghttp.RespondWith(http.StatusOK, "", http.Header{RequestIDHeader: {"backend-id"}}),
+		))
+		backendURL, err := url.Parse(backend.URL())
+		Expect(err).NotTo(HaveOccurred())
+
+		TrustRequestID = true
+		req.Header.Set("X-Request-Id", "1234-5678")
+		req = WithRequestID(rr, req)
+		NewBackendHandler("backend", backendURL, time.Second, time.Second, zerolog.Nop()).ServeHTTP(rr, req)
+
+		Expect(rr.Code).To(Equal(http.StatusOK))
+		Expect(rr.Header().Values(RequestIDHeader)).To(Equal([]string{"1234-5678"}))
+	})
+
+	It("doesn't share the request ID with other requests", func() {
+		tw := &teeResponseWriter{ResponseWriter: rr, limit: maxStoredResponseBytes}
+		WithRequestID(tw, req)
+		tw.WriteHeader(http.StatusOK)
+		tw.complete = true
+
+		sr, ok := tw.captured()
+		Expect(ok).To(BeTrue())
+		Expect(sr.header.Values(RequestIDHeader)).To(BeEmpty())
+	})
+})
@@ -0,0 +1,135 @@
+package handlers
+
+import (
+	"container/list"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// maxStoredResponseBytes is the largest response body a ResponseStore will
+// hold, so that one large download can't evict everything else.
+const maxStoredResponseBytes = 1 << 20
+
+type storedResponse struct {
+	key        string
+	path       string
+	statusCode int
+	header     http.Header
+	body       []byte
+	storedAt   time.Time
+	// vary holds the request header values the response was selected by.
+	vary map[string]string
+}
+
+func (sr *storedResponse) size() int64 {
+	return int64(len(sr.key) + len(sr.body))
+}
+
+func (sr *storedResponse) age() time.Duration {
+	return time.Since(sr.storedAt)
+}
+
+// matches reports whether the stored response can be used for req, given the
+// request headers listed in the response's Vary header.
+func (sr *storedResponse) matches(req *http.Request) bool {
+	for name, value := range sr.vary {
+		if req.Header.Get(name) != value {
+			return false
+		}
+	}
+	return true
+}
+
+// writeTo writes the stored response to w.
+func (sr *storedResponse) writeTo(w http.ResponseWriter) {
+	for name, values := range sr.header {
+		w.Header()[name] = append([]string(nil), values...)
+	}
+	w.WriteHeader(sr.statusCode)
+	_, _ = w.Write(sr.body)
+}
+
+// ResponseStore is a size-bounded, least recently used store of backend
+// responses. It is safe for concurrent use.
+type ResponseStore struct {
+	mu       sync.Mutex
+	maxBytes int64
+	size     int64
+	ll       *list.List
+	items    map[string]*list.Element
+}
+
+// NewResponseStore makes a ResponseStore holding at most maxBytes of
+// response bodies.
+func NewResponseStore(maxBytes int64) *ResponseStore {
+	return &ResponseStore{
+		maxBytes: maxBytes,
+		ll:       list.New(),
+		items:    make(map[string]*list.Element),
+	}
+}
+
+func (s *ResponseStore) get(key string) (*storedResponse, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	elem, ok := s.items[key]
+	if !ok {
+		return nil, false
+	}
+	s.ll.MoveToFront(elem)
+	return elem.Value.(*storedResponse), true
+}
+
+func (s *ResponseStore) set(sr *storedResponse) {
+	if sr.size() > min(s.maxBytes, maxStoredResponseBytes) {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if elem, ok := s.items[sr.key]; ok {
+		s.removeElement(elem)
+	}
+	s.items[sr.key] = s.ll.PushFront(sr)
+	s.size += sr.size()
+
+	for s.size > s.maxBytes {
+		s.removeElement(s.ll.Back())
+	}
+}
+
+// PurgePath removes every response for the given URL path, whatever its
+// query string, or if prefix is true every response for a path beneath it
+// as well. It returns the number of responses removed.
+func (s *ResponseStore) PurgePath(path string, prefix bool) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	removed := 0
+	for _, elem := range s.items {
+		sr := elem.Value.(*storedResponse)
+		if sr.path == path || (prefix && strings.HasPrefix(sr.path, strings.TrimSuffix(path, "/")+"/")) {
+			s.removeElement(elem)
+			removed++
+		}
+	}
+	return removed
+}
+
+func (s *ResponseStore) removeElement(elem *list.Element) {
+	sr := elem.Value.(*storedResponse)
+	s.ll.Remove(elem)
+	delete(s.items, sr.key)
+	s.size -= sr.size()
+}
+
+// Len returns the number of responses in the store.
+func (s *ResponseStore) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.ll.Len()
+}
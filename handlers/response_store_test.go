@@ -0,0 +1,115 @@
+package handlers
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("ResponseStore", func() {
+	var store *ResponseStore
+
+	response := func(key string, bodySize int) *storedResponse {
+		return &storedResponse{
+			key:        key,
+			path:       key,
+			statusCode: http.StatusOK,
+			header:     http.Header{},
+			body:       []byte(strings.Repeat("x", bodySize)),
+			storedAt:   time.Now(),
+		}
+	}
+
+	BeforeEach(func() {
+		store = NewResponseStore(100)
+	})
+
+	It("returns stored responses", func() {
+		store.set(response("/a", 10))
+
+		sr, ok := store.get("/a")
+		Expect(ok).To(BeTrue())
+		Expect(sr.body).To(HaveLen(10))
+
+		_, ok = store.get("/b")
+		Expect(ok).To(BeFalse())
+	})
+
+	It("replaces responses with the same key", func() {
+		store.set(response("/a", 10))
+		store.set(response("/a", 20))
+
+		sr, _ := store.get("/a")
+		Expect(sr.body).To(HaveLen(20))
+		Expect(store.Len()).To(Equal(1))
+	})
+
+	It("evicts the least recently used responses when full", func() {
+		store.set(response("/a", 40))
+		store.set(response("/b", 40))
+		store.get("/a")
+		store.set(response("/c", 40))
+
+		_, ok := store.get("/b")
+		Expect(ok).To(BeFalse())
+		_, ok = store.get("/a")
+		Expect(ok).To(BeTrue())
+		_, ok = store.get("/c")
+		Expect(ok).To(BeTrue())
+	})
+
+	It("does not store responses larger than the store", func() {
+		store.set(response("/a", 200))
+		Expect(store.Len()).To(BeZero())
+	})
+
+	It("purges responses by path", func() {
+		store.set(response("/a", 10))
+		store.set(response("/a/1", 10))
+		store.set(response("/ab", 10))
+
+		Expect(store.PurgePath("/a", false)).To(Equal(1))
+		Expect(store.Len()).To(Equal(2))
+	})
+
+	It("purges responses by path prefix", func() {
+		store.set(response("/a", 10))
+		store.set(response("/a/1", 10))
+		store.set(response("/a/1/2", 10))
+		store.set(response("/ab", 10))
+
+		Expect(store.PurgePath("/a", true)).To(Equal(3))
+		Expect(store.Len()).To(Equal(1))
+	})
+})
+
+var _ = Describe("Cache-Control parsing", func() {
+	It("parses directives and their values", func() {
+		header := http.Header{}
+		header.Add("Cache-Control", `public, max-age=60, stale-if-error="300"`)
+		header.Add("Cache-Control", "S-MAXAGE=120")
+
+		cc := parseCacheControl(header)
+		Expect(cc.has("public")).To(BeTrue())
+		Expect(cc.has("private")).To(BeFalse())
+
+		staleIfError, ok := cc.seconds("stale-if-error")
+		Expect(ok).To(BeTrue())
+		Expect(staleIfError).To(Equal(300 * time.Second))
+		Expect(cc.freshnessLifetime()).To(Equal(120 * time.Second))
+	})
+
+	It("ignores invalid delta-seconds", func() {
+		header := http.Header{"Cache-Control": {"max-age=soon"}}
+		_, ok := parseCacheControl(header).seconds("max-age")
+		Expect(ok).To(BeFalse())
+	})
+
+	It("lists the request headers a response varies on", func() {
+		header := http.Header{"Vary": {"accept-encoding, Cookie", "Accept"}}
+		Expect(varyHeaders(header)).To(Equal([]string{"Accept-Encoding", "Cookie", "Accept"}))
+	})
+})
@@ -0,0 +1,71 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+type rewriteHandler struct {
+	backendID string
+	source    string
+	target    string
+	prefix    bool
+	backend   http.Handler
+}
+
+// NewRewriteHandler returns a handler that passes requests for source to
+// backend with their path changed to target, without redirecting the client.
+// If prefix is set, the part of the request path after source is appended to
+// target. It returns an error if target isn't a path.
+func NewRewriteHandler(backendID, source, target string, prefix bool, backend http.Handler) (http.Handler, error) {
+	if !strings.HasPrefix(target, "/") || strings.HasPrefix(target, "//") || strings.ContainsAny(target, "?#") {
+		return nil, fmt.Errorf("rewrite target %q is not a path", target)
+	}
+	return &rewriteHandler{backendID, source, target, prefix, backend}, nil
+}
+
+func (handler *rewriteHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	r = withIncomingRequest(r)
+	rewritten := r.Clone(r.Context())
+	rewritten.URL.Path = handler.rewrite(r.URL.Path, handler.source, handler.target)
+	rewritten.URL.RawPath = ""
+	if r.URL.RawPath != "" {
+		// Keep the encoding of the rest of the path, such as %2F, if it can be
+		source := (&url.URL{Path: handler.source}).EscapedPath()
+		target := (&url.URL{Path: handler.target}).EscapedPath()
+		rewritten.URL.RawPath = handler.rewrite(r.URL.RawPath, source, target)
+	}
+	rewritten.RequestURI = rewritten.URL.RequestURI()
+
+	handler.backend.ServeHTTP(w, rewritten)
+
+	rewriteCountMetric.With(prometheus.Labels{
+		"backend_id": handler.backendID,
+	}).Inc()
+}
+
+func (handler *rewriteHandler) rewrite(path, source, target string) string {
+	if !handler.prefix {
+		return target
+	}
+	// The mux matched the path ignoring empty segments, so the suffix is what's
+	// left after as many non-empty segments as source has
+	suffix := path
+	for range len(pathSegments(source)) {
+		suffix = strings.TrimLeft(suffix, "/")
+		if i := strings.IndexByte(suffix, '/'); i >= 0 {
+			suffix = suffix[i:]
+		} else {
+			suffix = ""
+		}
+	}
+	rewritten := strings.TrimSuffix(target, "/") + suffix
+	if rewritten == "" {
+		return "/"
+	}
+	return rewritten
+}
@@ -0,0 +1,62 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Rewrite handler", func() {
+	var (
+		rr        *httptest.ResponseRecorder
+		backendRq *http.Request
+		backend   http.Handler
+	)
+
+	BeforeEach(func() {
+		rr = httptest.NewRecorder()
+		backendRq = nil
+		backend = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			backendRq = r
+			w.WriteHeader(http.StatusOK)
+		})
+	})
+
+	DescribeTable("rewrites the request path",
+		func(source, target string, prefix bool, url, expectedURI string) {
+			handler, err := NewRewriteHandler("collections", source, target, prefix, backend)
+			Expect(err).NotTo(HaveOccurred())
+
+			req := httptest.NewRequest(http.MethodGet, url, nil)
+			handler.ServeHTTP(rr, req)
+
+			Expect(rr.Code).To(Equal(http.StatusOK))
+			Expect(rr.Header().Get("Location")).To(BeEmpty())
+			Expect(backendRq.URL.RequestURI()).To(Equal(expectedURI))
+			Expect(backendRq.RequestURI).To(Equal(expectedURI))
+			Expect(req.URL.RequestURI()).To(Equal(url))
+		},
+		Entry("exact route", "/browse", "/topics", false, "/browse?a=b", "/topics?a=b"),
+		Entry("prefix route", "/browse/benefits", "/topics/benefits", true, "/browse/benefits/child-benefit", "/topics/benefits/child-benefit"),
+		Entry("prefix route itself", "/browse/benefits", "/topics/benefits", true, "/browse/benefits", "/topics/benefits"),
+		Entry("prefix route to the root", "/browse", "/", true, "/browse/benefits", "/benefits"),
+		Entry("root prefix route", "/", "/topics", true, "/benefits", "/topics/benefits"),
+		Entry("encoded path", "/browse", "/topics", true, "/browse/a%2Fb", "/topics/a%2Fb"),
+		Entry("duplicate slashes", "/browse/benefits", "/topics/benefits", true, "//browse//benefits/child-benefit", "/topics/benefits/child-benefit"),
+		Entry("trailing slash", "/browse/benefits", "/topics/benefits", true, "/browse/benefits/", "/topics/benefits/"),
+	)
+
+	DescribeTable("rejects targets which aren't paths",
+		func(target string) {
+			_, err := NewRewriteHandler("collections", "/browse", target, false, backend)
+			Expect(err).To(HaveOccurred())
+		},
+		Entry("relative path", "topics"),
+		Entry("URL", "https://www.gov.uk/topics"),
+		Entry("protocol-relative URL", "//www.gov.uk/topics"),
+		Entry("query string", "/topics?a=b"),
+		Entry("fragment", "/topics#a"),
+	)
+})
@@ -0,0 +1,146 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// SecurityHeaderPolicy configures the security headers, such as
+// Strict-Transport-Security and Content-Security-Policy, added to responses.
+type SecurityHeaderPolicy struct {
+	// Headers maps header names to the values added to every response which
+	// doesn't already have the header, including responses generated by
+	// Router.
+	Headers map[string]string `json:"headers"`
+	// Backends maps backend IDs to the policy for responses from that
+	// backend.
+	Backends map[string]BackendSecurityHeaders `json:"backends"`
+}
+
+// BackendSecurityHeaders overrides the security headers for responses from a
+// backend.
+type BackendSecurityHeaders struct {
+	// Disabled stops security headers being added to responses from the
+	// backend.
+	Disabled bool `json:"disabled"`
+	// Headers override the values of the default headers for the backend. An
+	// empty value stops that header being added.
+	Headers map[string]string `json:"headers"`
+}
+
+// SecurityHeaders holds the security header policy, or nil if there is none.
+var SecurityHeaders *SecurityHeaderPolicy
+
+// LoadSecurityHeaderPolicy reads the security header policy from a JSON file.
+func LoadSecurityHeaderPolicy(path string) (*SecurityHeaderPolicy, error) {
+	data, err := os.ReadFile(path) //nolint:gosec // path is from ROUTER_SECURITY_HEADERS_FILE env var, controlled by user
+	if err != nil {
+		return nil, fmt.Errorf("failed to read security header policy: %w", err)
+	}
+
+	policy := &SecurityHeaderPolicy{}
+	if err := json.Unmarshal(data, policy); err != nil {
+		return nil, fmt.Errorf("failed to parse security header policy: %w", err)
+	}
+
+	if err := validateSecurityHeaders(policy.Headers); err != nil {
+		return nil, err
+	}
+	for backendID, backend := range policy.Backends {
+		if err := validateSecurityHeaders(backend.Headers); err != nil {
+			return nil, fmt.Errorf("invalid security headers for backend %s: %w", backendID, err)
+		}
+	}
+
+	return policy, nil
+}
+
+func validateSecurityHeaders(headers map[string]string) error {
+	for name, value := range headers {
+		if !validHeaderName(name) || strings.ContainsAny(value, "\r\n") {
+			return fmt.Errorf("invalid security header %q", name)
+		}
+	}
+	return nil
+}
+
+// forBackend returns the headers for responses from backendID, or for
+// responses generated by Router if backendID is empty.
+func (policy *SecurityHeaderPolicy) forBackend(backendID string) map[string]string {
+	backend, ok := policy.Backends[backendID]
+	if !ok {
+		return policy.Headers
+	}
+	if backend.Disabled {
+		return nil
+	}
+	headers := make(map[string]string, len(policy.Headers)+len(backend.Headers))
+	for name, value := range policy.Headers {
+		headers[name] = value
+	}
+	for name, value := range backend.Headers {
+		headers[name] = value
+	}
+	return headers
+}
+
+// AddSecurityHeaders returns a ResponseWriter that adds the security headers
+// to the response written to w, or w itself if there is no policy.
+func AddSecurityHeaders(w http.ResponseWriter) http.ResponseWriter {
+	if SecurityHeaders == nil {
+		return w
+	}
+	return &securityHeadersWriter{ResponseWriter: w, policy: SecurityHeaders}
+}
+
+// NewBackendSecurityHeadersHandler returns a handler that serves requests
+// with next, using the security headers for backendID.
+func NewBackendSecurityHeadersHandler(backendID string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if sw, ok := w.(*securityHeadersWriter); ok {
+			sw.backendID = backendID
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+type securityHeadersWriter struct {
+	http.ResponseWriter
+	policy      *SecurityHeaderPolicy
+	backendID   string
+	wroteHeader bool
+}
+
+func (sw *securityHeadersWriter) WriteHeader(code int) {
+	if !sw.wroteHeader && code >= http.StatusOK {
+		sw.wroteHeader = true
+		header := sw.Header()
+		for name, value := range sw.policy.forBackend(sw.backendID) {
+			if value != "" && header.Get(name) == "" {
+				header.Set(name, value)
+			}
+		}
+	}
+	sw.ResponseWriter.WriteHeader(code)
+}
+
+func (sw *securityHeadersWriter) Write(b []byte) (int, error) {
+	if !sw.wroteHeader {
+		sw.WriteHeader(http.StatusOK)
+	}
+	return sw.ResponseWriter.Write(b)
+}
+
+func (sw *securityHeadersWriter) Flush() {
+	if !sw.wroteHeader {
+		sw.WriteHeader(http.StatusOK)
+	}
+	_ = http.NewResponseController(sw.ResponseWriter).Flush()
+}
+
+func (sw *securityHeadersWriter) Unwrap() http.ResponseWriter {
+	return sw.ResponseWriter
+}
@@ -0,0 +1,103 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Security headers", func() {
+	var rr *httptest.ResponseRecorder
+
+	loadPolicy := func(content string) (*SecurityHeaderPolicy, error) {
+		path := filepath.Join(GinkgoT().TempDir(), "security-headers.json")
+		Expect(os.WriteFile(path, []byte(content), 0o600)).To(Succeed())
+		return LoadSecurityHeaderPolicy(path)
+	}
+
+	serve := func(handler http.Handler) {
+		handler.ServeHTTP(AddSecurityHeaders(rr), httptest.NewRequest(http.MethodGet, "/foo", nil))
+	}
+
+	BeforeEach(func() {
+		rr = httptest.NewRecorder()
+
+		policy, err := loadPolicy(`{
+			"headers": {
+				"Strict-Transport-Security": "max-age=31536000",
+				"X-Content-Type-Options": "nosniff",
+				"Content-Security-Policy": "default-src 'self'"
+			},
+			"backends": {
+				"whitehall": {"headers": {"Content-Security-Policy": "", "Referrer-Policy": "no-referrer"}},
+				"legacy": {"disabled": true}
+			}
+		}`)
+		Expect(err).NotTo(HaveOccurred())
+		SecurityHeaders = policy
+	})
+
+	AfterEach(func() {
+		SecurityHeaders = nil
+	})
+
+	It("adds the headers to responses generated by Router", func() {
+		serve(http.NotFoundHandler())
+		Expect(rr.Code).To(Equal(http.StatusNotFound))
+		Expect(rr.Header().Get("Strict-Transport-Security")).To(Equal("max-age=31536000"))
+		Expect(rr.Header().Get("X-Content-Type-Options")).To(Equal("nosniff"))
+		Expect(rr.Header().Get("Content-Security-Policy")).To(Equal("default-src 'self'"))
+	})
+
+	It("adds the headers to responses which are written without a status", func() {
+		serve(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+			_, _ = w.Write([]byte("ok"))
+		}))
+		Expect(rr.Code).To(Equal(http.StatusOK))
+		Expect(rr.Header().Get("Strict-Transport-Security")).To(Equal("max-age=31536000"))
+	})
+
+	It("doesn't replace headers the response already has", func() {
+		serve(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+			w.Header().Set("Content-Security-Policy", "default-src 'none'")
+			w.WriteHeader(http.StatusOK)
+		}))
+		Expect(rr.Header().Values("Content-Security-Policy")).To(Equal([]string{"default-src 'none'"}))
+	})
+
+	It("uses the overrides for a backend", func() {
+		serve(NewBackendSecurityHeadersHandler("whitehall", http.NotFoundHandler()))
+		Expect(rr.Header().Get("Strict-Transport-Security")).To(Equal("max-age=31536000"))
+		Expect(rr.Header().Get("Referrer-Policy")).To(Equal("no-referrer"))
+		Expect(rr.Header().Values("Content-Security-Policy")).To(BeEmpty())
+	})
+
+	It("doesn't add headers for backends which opt out", func() {
+		serve(NewBackendSecurityHeadersHandler("legacy", http.NotFoundHandler()))
+		Expect(rr.Header().Values("Strict-Transport-Security")).To(BeEmpty())
+	})
+
+	It("uses the default headers for other backends", func() {
+		serve(NewBackendSecurityHeadersHandler("frontend", http.NotFoundHandler()))
+		Expect(rr.Header().Get("Content-Security-Policy")).To(Equal("default-src 'self'"))
+	})
+
+	It("doesn't wrap the ResponseWriter when there is no policy", func() {
+		SecurityHeaders = nil
+		Expect(AddSecurityHeaders(rr)).To(BeIdenticalTo(rr))
+	})
+
+	DescribeTable("fails to load invalid policies",
+		func(content string) {
+			_, err := loadPolicy(content)
+			Expect(err).To(HaveOccurred())
+		},
+		Entry("invalid JSON", `{"headers": `),
+		Entry("invalid header name", `{"headers": {"X Frame": "DENY"}}`),
+		Entry("invalid header value", `{"backends": {"frontend": {"headers": {"X-Frame-Options": "DENY\r\nSet-Cookie: a=b"}}}}`),
+	)
+})
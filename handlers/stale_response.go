@@ -0,0 +1,143 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// StaleResponses, if set, holds recent successful responses from backends
+// which allow stale-if-error, so that they can be served in place of a 502 or
+// 504 if a later request to the backend fails.
+var StaleResponses *ResponseStore
+
+const staleWarning = `111 - "Revalidation Failed"`
+
+type incomingRequestKey struct{}
+
+// withIncomingRequest records r in its context as the request that Router
+// received, unless one has been recorded already, so that the request made to
+// the backend for it can be told apart from those for other hosts.
+func withIncomingRequest(r *http.Request) *http.Request {
+	if _, ok := r.Context().Value(incomingRequestKey{}).(*http.Request); ok {
+		return r
+	}
+	return r.WithContext(context.WithValue(r.Context(), incomingRequestKey{}, r))
+}
+
+// incomingRequest returns the request that Router received for req, or req
+// itself if there isn't one recorded.
+func incomingRequest(req *http.Request) *http.Request {
+	if in, ok := req.Context().Value(incomingRequestKey{}).(*http.Request); ok {
+		return in
+	}
+	return req
+}
+
+// responseStoreKey returns the key for the response to req. Backends build
+// absolute URLs from the host the request was for, so it's part of the key.
+func responseStoreKey(backendID string, req *http.Request) string {
+	in := incomingRequest(req)
+	return backendID + " " + in.Host + " " + in.Header.Get("X-Forwarded-Host") + " " + req.URL.String()
+}
+
+// allowsStaleIfError reports whether resp may be stored and served stale if
+// a later request to the backend fails.
+func allowsStaleIfError(req *http.Request, resp *http.Response) bool {
+	if req.Method != http.MethodGet || req.Header.Get("Authorization") != "" {
+		return false
+	}
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("Set-Cookie") != "" || resp.Header.Get("Vary") == "*" {
+		return false
+	}
+
+	cc := parseCacheControl(resp.Header)
+	return cc.has("stale-if-error") && !cc.has("no-store") && !cc.has("private")
+}
+
+// newStoredResponse captures the parts of resp needed to replay it later,
+// except for the body which is added once it has been read.
+func newStoredResponse(key string, req *http.Request, resp *http.Response) *storedResponse {
+	sr := &storedResponse{
+		key:        key,
+		statusCode: resp.StatusCode,
+		header:     resp.Header.Clone(),
+		storedAt:   time.Now(),
+		vary:       make(map[string]string),
+	}
+
+	if age, err := strconv.Atoi(resp.Header.Get("Age")); err == nil && age > 0 {
+		sr.storedAt = sr.storedAt.Add(-time.Duration(age) * time.Second)
+	}
+
+	for _, name := range varyHeaders(resp.Header) {
+		sr.vary[name] = req.Header.Get(name)
+	}
+	return sr
+}
+
+func (bt *backendTransport) staleResponse(req *http.Request) (*http.Response, bool) {
+	if StaleResponses == nil || req.Method != http.MethodGet {
+		return nil, false
+	}
+
+	sr, ok := StaleResponses.get(responseStoreKey(bt.backendID, req))
+	if !ok || !sr.matches(req) {
+		return nil, false
+	}
+
+	cc := parseCacheControl(sr.header)
+	staleIfError, _ := cc.seconds("stale-if-error")
+	if sr.age() > responseFreshness(sr.header)+staleIfError {
+		return nil, false
+	}
+
+	resp := sr.response()
+	resp.Header.Add("Warning", staleWarning)
+	return resp, true
+}
+
+// response builds a new http.Response from the stored response.
+func (sr *storedResponse) response() *http.Response {
+	resp := &http.Response{
+		StatusCode:    sr.statusCode,
+		Header:        sr.header.Clone(),
+		Body:          io.NopCloser(bytes.NewReader(sr.body)),
+		ContentLength: int64(len(sr.body)),
+	}
+	resp.Header.Set("Age", strconv.Itoa(int(sr.age().Seconds())))
+	return resp
+}
+
+// capturingBody wraps a response body, passing a copy of it to onComplete
+// once it has been read to the end, unless it grew larger than limit.
+type capturingBody struct {
+	io.ReadCloser
+	buf        bytes.Buffer
+	limit      int
+	onComplete func([]byte)
+}
+
+func (b *capturingBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if b.onComplete == nil {
+		return n, err
+	}
+
+	if b.buf.Len()+n > b.limit {
+		b.onComplete = nil
+		b.buf = bytes.Buffer{}
+		return n, err
+	}
+	b.buf.Write(p[:n])
+
+	if errors.Is(err, io.EOF) {
+		b.onComplete(b.buf.Bytes())
+		b.onComplete = nil
+	}
+	return n, err
+}
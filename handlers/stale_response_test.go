@@ -0,0 +1,154 @@
+package handlers
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/onsi/gomega/ghttp"
+	"github.com/rs/zerolog"
+)
+
+var _ = Describe("Stale responses", func() {
+	var (
+		backend    *ghttp.Server
+		backendURL *url.URL
+		router     http.Handler
+	)
+
+	serve := func(path string, headers map[string]string) *http.Response {
+		rw := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, backendURL.String()+path, nil)
+		for k, v := range headers {
+			req.Header.Set(k, v)
+		}
+		router.ServeHTTP(rw, req)
+		return rw.Result()
+	}
+
+	respondWith := func(cacheControl string) http.HandlerFunc {
+		return ghttp.RespondWith(http.StatusOK, "fresh", http.Header{
+			"Cache-Control": {cacheControl},
+			"Vary":          {"Accept-Language"},
+		})
+	}
+
+	BeforeEach(func() {
+		var err error
+		backend = ghttp.NewServer()
+		backendURL, err = url.Parse(backend.URL())
+		Expect(err).NotTo(HaveOccurred())
+
+		StaleResponses = NewResponseStore(1 << 20)
+		router = NewBackendHandler("backend-stale", backendURL, time.Second, time.Second, zerolog.Nop())
+	})
+
+	AfterEach(func() {
+		StaleResponses = nil
+		backend.Close()
+	})
+
+	It("serves a stored response when the backend is down", func() {
+		backend.AppendHandlers(respondWith("max-age=0, stale-if-error=60"))
+		Expect(serve("/page", nil).StatusCode).To(Equal(http.StatusOK))
+
+		backend.Close()
+		resp := serve("/page", nil)
+		Expect(resp.StatusCode).To(Equal(http.StatusOK))
+		Expect(readAll(resp)).To(Equal("fresh"))
+		Expect(resp.Header.Get("Warning")).To(Equal(staleWarning))
+		Expect(resp.Header.Get("Age")).To(Equal("0"))
+	})
+
+	It("does not serve responses stored for other variants", func() {
+		backend.AppendHandlers(respondWith("stale-if-error=60"))
+		serve("/page", map[string]string{"Accept-Language": "cy"})
+
+		backend.Close()
+		Expect(serve("/page", map[string]string{"Accept-Language": "en"}).StatusCode).To(Equal(http.StatusBadGateway))
+	})
+
+	It("does not serve responses stored for other hosts", func() {
+		backend.AppendHandlers(respondWith("stale-if-error=60"))
+		serve("/page", map[string]string{"X-Forwarded-Host": "www.gov.uk"})
+
+		backend.Close()
+		Expect(serve("/page", map[string]string{"X-Forwarded-Host": "assets.publishing.service.gov.uk"}).StatusCode).To(Equal(http.StatusBadGateway))
+
+		req := httptest.NewRequest(http.MethodGet, "http://other.example.com/page", nil)
+		req.Header.Set("X-Forwarded-Host", "www.gov.uk")
+		rw := httptest.NewRecorder()
+		router.ServeHTTP(rw, req)
+		Expect(rw.Code).To(Equal(http.StatusBadGateway))
+
+		Expect(serve("/page", map[string]string{"X-Forwarded-Host": "www.gov.uk"}).StatusCode).To(Equal(http.StatusOK))
+	})
+
+	It("does not store responses without stale-if-error", func() {
+		backend.AppendHandlers(respondWith("max-age=60"))
+		serve("/page", nil)
+
+		backend.Close()
+		Expect(serve("/page", nil).StatusCode).To(Equal(http.StatusBadGateway))
+	})
+
+	It("does not store private responses", func() {
+		backend.AppendHandlers(respondWith("private, stale-if-error=60"))
+		serve("/page", nil)
+
+		backend.Close()
+		Expect(serve("/page", nil).StatusCode).To(Equal(http.StatusBadGateway))
+	})
+
+	It("does not serve responses after their path is purged", func() {
+		baseURL := *backendURL
+		baseURL.Path = "/base/"
+		router = NewBackendHandler("backend-stale", &baseURL, time.Second, time.Second, zerolog.Nop())
+		backend.AppendHandlers(ghttp.CombineHandlers(
+			ghttp.VerifyRequest(http.MethodGet, "/base/page"),
+			respondWith("max-age=0, stale-if-error=60"),
+		))
+		serve("/page", nil)
+		Expect(StaleResponses.PurgePath("/page", false)).To(Equal(1))
+
+		backend.Close()
+		Expect(serve("/page", nil).StatusCode).To(Equal(http.StatusBadGateway))
+	})
+
+	It("does not serve responses after the incoming path of a rewrite route is purged", func() {
+		rewrite, err := NewRewriteHandler("backend-stale", "/browse", "/topics", true, router)
+		Expect(err).NotTo(HaveOccurred())
+		router = rewrite
+		backend.AppendHandlers(ghttp.CombineHandlers(
+			ghttp.VerifyRequest(http.MethodGet, "/topics/benefits/x"),
+			respondWith("max-age=0, stale-if-error=60"),
+		))
+		serve("/browse/benefits/x", nil)
+		Expect(StaleResponses.PurgePath("/topics/benefits/x", false)).To(Equal(0))
+		Expect(StaleResponses.PurgePath("/browse/benefits/x", false)).To(Equal(1))
+
+		backend.Close()
+		Expect(serve("/browse/benefits/x", nil).StatusCode).To(Equal(http.StatusBadGateway))
+	})
+
+	It("does not serve responses which are too old", func() {
+		backend.AppendHandlers(ghttp.RespondWith(http.StatusOK, "fresh", http.Header{
+			"Cache-Control": {"max-age=10, stale-if-error=10"},
+			"Age":           {"30"},
+		}))
+		serve("/page", nil)
+
+		backend.Close()
+		Expect(serve("/page", nil).StatusCode).To(Equal(http.StatusBadGateway))
+	})
+})
+
+func readAll(resp *http.Response) string {
+	body, err := io.ReadAll(resp.Body)
+	Expect(err).NotTo(HaveOccurred())
+	return string(body)
+}
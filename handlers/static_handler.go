@@ -0,0 +1,162 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// StaticFilesDir is the directory that static routes serve files from. If
+// it's empty, static routes can only serve inline responses.
+var StaticFilesDir string
+
+const (
+	staticInlineHandlerType = "inline"
+	staticFileHandlerType   = "file"
+)
+
+// StaticResponse is the response served by a static route. It is either an
+// inline Body or a File in StaticFilesDir.
+type StaticResponse struct {
+	// Status is the HTTP status code of the response, defaulting to 200.
+	Status int `json:"status"`
+	// ContentType is the Content-Type of the response. It defaults to
+	// text/plain for inline responses, and is detected from the file name
+	// or contents for files.
+	ContentType string `json:"content_type"`
+	// Headers are extra headers to set on the response.
+	Headers map[string]string `json:"headers"`
+	// Body is the body of an inline response.
+	Body string `json:"body"`
+	// File is the path of the file to serve, relative to StaticFilesDir. For
+	// prefix routes it can be a directory, in which case the rest of the
+	// request path is the file within it.
+	File string `json:"file"`
+}
+
+func (response *StaticResponse) validate() error {
+	if response.Status != 0 && (response.Status < 200 || response.Status > 599) {
+		return fmt.Errorf("invalid status %d", response.Status)
+	}
+	for name, value := range response.Headers {
+		if name == "" || strings.ContainsAny(name, " :\r\n") || strings.ContainsAny(value, "\r\n") {
+			return fmt.Errorf("invalid header %q", name)
+		}
+	}
+	if response.File == "" {
+		return nil
+	}
+	if response.Body != "" {
+		return errors.New("response can't have both a body and a file")
+	}
+	if StaticFilesDir == "" {
+		return errors.New("no static files directory configured")
+	}
+	if !filepath.IsLocal(response.File) {
+		return fmt.Errorf("file %q is outside the static files directory", response.File)
+	}
+	return nil
+}
+
+type staticHandler struct {
+	source   string
+	prefix   bool
+	response StaticResponse
+}
+
+// NewStaticHandler returns a handler that serves response to requests for
+// source, or an error if response isn't valid.
+func NewStaticHandler(source string, prefix bool, response StaticResponse) (http.Handler, error) {
+	if err := response.validate(); err != nil {
+		return nil, err
+	}
+	if response.Status == 0 {
+		response.Status = http.StatusOK
+	}
+	return &staticHandler{source, prefix, response}, nil
+}
+
+func (handler *staticHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	for name, value := range handler.response.Headers {
+		w.Header().Set(name, value)
+	}
+
+	if handler.response.File != "" {
+		handler.serveFile(w, r)
+		return
+	}
+
+	contentType := handler.response.ContentType
+	if contentType == "" {
+		contentType = "text/plain; charset=utf-8"
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.WriteHeader(handler.response.Status)
+	_, _ = io.WriteString(w, handler.response.Body)
+
+	staticResponseCountMetric.With(prometheus.Labels{
+		"response_type": staticInlineHandlerType,
+	}).Inc()
+}
+
+func (handler *staticHandler) serveFile(w http.ResponseWriter, r *http.Request) {
+	file, info, err := openStaticFile(handler.response.File)
+	if err == nil && info.IsDir() && handler.prefix {
+		_ = file.Close()
+		// Clean the rest of the path first so it can't leave the directory
+		name := path.Join(handler.response.File, path.Clean("/"+strings.TrimPrefix(r.URL.Path, handler.source)))
+		file, info, err = openStaticFile(name)
+	}
+	if err == nil && !info.Mode().IsRegular() {
+		_ = file.Close()
+		err = fmt.Errorf("%s is not a regular file", info.Name())
+	}
+	if err != nil {
+		if !ServeErrorPage(w, r, http.StatusNotFound) {
+			http.NotFound(w, r)
+		}
+		return
+	}
+	defer func() { _ = file.Close() }()
+
+	if handler.response.ContentType != "" {
+		w.Header().Set("Content-Type", handler.response.ContentType)
+	}
+	if handler.response.Status == http.StatusOK {
+		// ServeContent handles conditional and range requests
+		http.ServeContent(w, r, info.Name(), info.ModTime(), file)
+	} else {
+		if contentType := mime.TypeByExtension(filepath.Ext(info.Name())); w.Header().Get("Content-Type") == "" && contentType != "" {
+			w.Header().Set("Content-Type", contentType)
+		}
+		w.WriteHeader(handler.response.Status)
+		_, _ = io.Copy(w, file)
+	}
+
+	staticResponseCountMetric.With(prometheus.Labels{
+		"response_type": staticFileHandlerType,
+	}).Inc()
+}
+
+// openStaticFile opens name within StaticFilesDir. Paths which would leave
+// the directory, including through symlinks, fail to open.
+func openStaticFile(name string) (*os.File, os.FileInfo, error) {
+	file, err := os.OpenInRoot(StaticFilesDir, filepath.FromSlash(name))
+	if err != nil {
+		return nil, nil, err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		_ = file.Close()
+		return nil, nil, err
+	}
+	return file, info, nil
+}
@@ -0,0 +1,116 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Static handler", func() {
+	var rr *httptest.ResponseRecorder
+
+	serve := func(handler http.Handler, path string) {
+		handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, path, nil))
+	}
+
+	BeforeEach(func() {
+		rr = httptest.NewRecorder()
+
+		StaticFilesDir = GinkgoT().TempDir()
+		Expect(os.MkdirAll(filepath.Join(StaticFilesDir, "well-known"), 0o750)).To(Succeed())
+		Expect(os.WriteFile(filepath.Join(StaticFilesDir, "robots.txt"), []byte("User-agent: *\n"), 0o600)).To(Succeed())
+		Expect(os.WriteFile(filepath.Join(StaticFilesDir, "well-known", "security.txt"), []byte("Contact: security@example.com\n"), 0o600)).To(Succeed())
+		Expect(os.WriteFile(filepath.Join(StaticFilesDir, "maintenance.html"), []byte("<h1>Down for maintenance</h1>"), 0o600)).To(Succeed())
+	})
+
+	AfterEach(func() {
+		StaticFilesDir = ""
+	})
+
+	It("serves an inline response", func() {
+		handler, err := NewStaticHandler("/robots.txt", false, StaticResponse{
+			Body:    "User-agent: *\nDisallow: /search\n",
+			Headers: map[string]string{"Cache-Control": "max-age=3600, public"},
+		})
+		Expect(err).NotTo(HaveOccurred())
+
+		serve(handler, "/robots.txt")
+		Expect(rr.Code).To(Equal(http.StatusOK))
+		Expect(rr.Header().Get("Content-Type")).To(Equal("text/plain; charset=utf-8"))
+		Expect(rr.Header().Get("Cache-Control")).To(Equal("max-age=3600, public"))
+		Expect(rr.Body.String()).To(Equal("User-agent: *\nDisallow: /search\n"))
+	})
+
+	It("serves an inline response with its own status and content type", func() {
+		handler, err := NewStaticHandler("/", true, StaticResponse{
+			Status:      http.StatusServiceUnavailable,
+			ContentType: "text/html; charset=utf-8",
+			Headers:     map[string]string{"Retry-After": "3600"},
+			Body:        "<h1>Down for maintenance</h1>",
+		})
+		Expect(err).NotTo(HaveOccurred())
+
+		serve(handler, "/government")
+		Expect(rr.Code).To(Equal(http.StatusServiceUnavailable))
+		Expect(rr.Header().Get("Content-Type")).To(Equal("text/html; charset=utf-8"))
+		Expect(rr.Header().Get("Retry-After")).To(Equal("3600"))
+		Expect(rr.Body.String()).To(Equal("<h1>Down for maintenance</h1>"))
+	})
+
+	It("serves a file", func() {
+		handler, err := NewStaticHandler("/robots.txt", false, StaticResponse{File: "robots.txt"})
+		Expect(err).NotTo(HaveOccurred())
+
+		serve(handler, "/robots.txt")
+		Expect(rr.Code).To(Equal(http.StatusOK))
+		Expect(rr.Header().Get("Content-Type")).To(Equal("text/plain; charset=utf-8"))
+		Expect(rr.Header().Get("Last-Modified")).NotTo(BeEmpty())
+		Expect(rr.Body.String()).To(Equal("User-agent: *\n"))
+	})
+
+	It("serves a file with its own status", func() {
+		handler, err := NewStaticHandler("/", true, StaticResponse{Status: http.StatusServiceUnavailable, File: "maintenance.html"})
+		Expect(err).NotTo(HaveOccurred())
+
+		serve(handler, "/government")
+		Expect(rr.Code).To(Equal(http.StatusServiceUnavailable))
+		Expect(rr.Header().Get("Content-Type")).To(Equal("text/html; charset=utf-8"))
+		Expect(rr.Body.String()).To(Equal("<h1>Down for maintenance</h1>"))
+	})
+
+	DescribeTable("serves files from a directory for prefix routes",
+		func(path string, expectedCode int) {
+			handler, err := NewStaticHandler("/.well-known", true, StaticResponse{File: "well-known"})
+			Expect(err).NotTo(HaveOccurred())
+
+			serve(handler, path)
+			Expect(rr.Code).To(Equal(expectedCode))
+		},
+		Entry("file", "/.well-known/security.txt", http.StatusOK),
+		Entry("missing file", "/.well-known/change-password", http.StatusNotFound),
+		Entry("directory", "/.well-known", http.StatusNotFound),
+		Entry("parent directory", "/.well-known/../robots.txt", http.StatusNotFound),
+	)
+
+	DescribeTable("rejects invalid responses",
+		func(response StaticResponse) {
+			_, err := NewStaticHandler("/robots.txt", false, response)
+			Expect(err).To(HaveOccurred())
+		},
+		Entry("invalid status", StaticResponse{Status: 99}),
+		Entry("invalid header", StaticResponse{Headers: map[string]string{"X-Foo": "bar\r\nSet-Cookie: a=b"}}),
+		Entry("body and file", StaticResponse{Body: "User-agent: *", File: "robots.txt"}),
+		Entry("file outside the directory", StaticResponse{File: "../robots.txt"}),
+		Entry("absolute file", StaticResponse{File: "/etc/passwd"}),
+	)
+
+	It("rejects files when there is no static files directory", func() {
+		StaticFilesDir = ""
+		_, err := NewStaticHandler("/robots.txt", false, StaticResponse{File: "robots.txt"})
+		Expect(err).To(MatchError(ContainSubstring("no static files directory")))
+	})
+})
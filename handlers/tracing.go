@@ -0,0 +1,86 @@
+package handlers
+
+import (
+	"net/http"
+
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// TracingEnabled makes Router create OpenTelemetry spans for the requests it
+// serves and the requests it makes to backends, using the global tracer
+// provider and propagator.
+var TracingEnabled bool
+
+// Span attributes set by Router, in addition to the standard HTTP ones.
+const (
+	HandlerTypeAttribute = attribute.Key("router.handler_type")
+	BackendIDAttribute   = attribute.Key("router.backend_id")
+	ErrorReasonAttribute = attribute.Key("router.error_reason")
+	RouteFoundAttribute  = attribute.Key("router.route_found")
+)
+
+// TraceRequests returns a handler that serves requests with next in a server
+// span, continuing the trace in the request's traceparent header if it has
+// one. It returns next itself if tracing isn't enabled.
+func TraceRequests(next http.Handler) http.Handler {
+	if !TracingEnabled {
+		return next
+	}
+	return otelhttp.NewHandler(next, "router", otelhttp.WithSpanNameFormatter(spanName))
+}
+
+// NewTracingHandler returns a handler that records handlerType on the span for
+// the request and then serves it with next.
+func NewTracingHandler(handlerType string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		trace.SpanFromContext(r.Context()).SetAttributes(HandlerTypeAttribute.String(handlerType))
+		next.ServeHTTP(w, r)
+	})
+}
+
+// TraceRouteLookup finds the route for r with lookup in a span of its own,
+// recording whether a route was found. The span is only started if the span
+// for the request is being recorded, so requests which aren't traced don't
+// pay for it.
+func TraceRouteLookup(r *http.Request, lookup func() (http.Handler, bool)) (http.Handler, bool) {
+	parent := trace.SpanFromContext(r.Context())
+	if !parent.IsRecording() {
+		return lookup()
+	}
+
+	_, span := parent.TracerProvider().Tracer("github.com/alphagov/router/triemux").Start(r.Context(), "triemux.lookup")
+	defer span.End()
+
+	handler, ok := lookup()
+	span.SetAttributes(RouteFoundAttribute.Bool(ok))
+	return handler, ok
+}
+
+// traceBackendRequests returns a RoundTripper that makes requests to a backend
+// with transport in client spans, which pass the trace on to the backend in
+// the traceparent header.
+func traceBackendRequests(backendID string, transport http.RoundTripper) http.RoundTripper {
+	if !TracingEnabled {
+		return transport
+	}
+	return otelhttp.NewTransport(transport,
+		otelhttp.WithSpanNameFormatter(spanName),
+		otelhttp.WithSpanOptions(trace.WithAttributes(BackendIDAttribute.String(backendID))),
+	)
+}
+
+// recordBackendError marks the span for a backend request as failed for
+// reason.
+func recordBackendError(req *http.Request, err error, reason string) {
+	span := trace.SpanFromContext(req.Context())
+	span.SetAttributes(ErrorReasonAttribute.String(reason))
+	span.RecordError(err)
+	span.SetStatus(codes.Error, reason)
+}
+
+func spanName(_ string, r *http.Request) string {
+	return r.Method
+}
@@ -0,0 +1,81 @@
+package handlers
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/rs/zerolog"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/otel/trace/noop"
+)
+
+var _ = Describe("Tracing", func() {
+	var (
+		recorder *tracetest.SpanRecorder
+		rr       *httptest.ResponseRecorder
+	)
+
+	BeforeEach(func() {
+		recorder = tracetest.NewSpanRecorder()
+		otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+		TracingEnabled = true
+		rr = httptest.NewRecorder()
+	})
+
+	AfterEach(func() {
+		TracingEnabled = false
+		otel.SetTracerProvider(noop.NewTracerProvider())
+	})
+
+	It("doesn't wrap handlers when tracing isn't enabled", func() {
+		TracingEnabled = false
+		next := http.RedirectHandler("/bar", http.StatusFound)
+		Expect(TraceRequests(next)).To(BeIdenticalTo(next))
+	})
+
+	It("records the handler type on the server span", func() {
+		handler := TraceRequests(NewTracingHandler("redirect", http.NotFoundHandler()))
+		handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/foo", nil))
+
+		spans := recorder.Ended()
+		Expect(spans).To(HaveLen(1))
+		Expect(spans[0].SpanKind()).To(Equal(trace.SpanKindServer))
+		Expect(spans[0].Attributes()).To(ContainElement(HandlerTypeAttribute.String("redirect")))
+	})
+
+	It("records why requests to backends failed on the client span", func() {
+		// Listen then close to get an address with nothing listening on it.
+		l, err := net.Listen("tcp", "127.0.0.1:0")
+		Expect(err).NotTo(HaveOccurred())
+		backendURL, err := url.Parse("http://" + l.Addr().String())
+		Expect(err).NotTo(HaveOccurred())
+		Expect(l.Close()).To(Succeed())
+
+		handler := TraceRequests(NewBackendHandler("backend-refused", backendURL, time.Second, time.Second, zerolog.Nop()))
+		handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/foo", nil))
+		Expect(rr.Code).To(Equal(http.StatusBadGateway))
+
+		var client sdktrace.ReadOnlySpan
+		for _, span := range recorder.Ended() {
+			if span.SpanKind() == trace.SpanKindClient {
+				client = span
+			}
+		}
+		Expect(client).NotTo(BeNil())
+		Expect(client.Status().Code).To(Equal(codes.Error))
+		Expect(client.Attributes()).To(ContainElements(
+			attribute.String("router.backend_id", "backend-refused"),
+			ErrorReasonAttribute.String(ReasonConnectionRefused),
+		))
+	})
+})
@@ -44,20 +44,14 @@ func ExportRoutes(filePath string, logger zerolog.Logger) error {
 
 	routeCount := 0
 	for rows.Next() {
-		route := &Route{}
-		scans := []any{
-			&route.BackendID,
-			&route.IncomingPath,
-			&route.RouteType,
-			&route.RedirectTo,
-			&route.SegmentsMode,
-			&route.SchemaName,
-			&route.Details,
+		row := &routeRow{}
+		if err := row.scan(rows); err != nil {
+			return fmt.Errorf("failed to scan route: %w", err)
 		}
-
-		err := rows.Scan(scans...)
+		route, err := row.route()
 		if err != nil {
-			return fmt.Errorf("failed to scan route: %w", err)
+			logger.Warn().Interface("incoming_path", row.IncomingPath).Err(err).Msg("invalid route, skipping")
+			continue
 		}
 
 		// Serialize route to JSON
@@ -31,6 +31,10 @@ Routes are mapped to handlers and added to the triemux:
 (i) Backend handlers are associated with backend routes via the backends map
 (ii) Redirect handlers are created for redirect routes
 (iii) Gone handlers are created for gone routes
+(iv) Static handlers are created for routes with a response
+(v) Rewrite handlers are created for routes with a rewrite_to path, wrapping their backend handler
+Backend and rewrite routes with header rules pass them to their backend handler, and use the security
+headers for their backend.
 */
 func addHandler(mux *triemux.Mux, route *Route, backends map[string]http.Handler, logger zerolog.Logger) error {
 	if route.IncomingPath == nil || route.RouteType == nil {
@@ -48,38 +52,109 @@ func addHandler(mux *triemux.Mux, route *Route, backends map[string]http.Handler
 		return nil //nolint:nilerr
 	}
 
+	// Add the handler to the mux, recording the handler type in traces and the route in the access log
+	handlerType := route.handlerType()
+	handle := func(backendID string, handler http.Handler) {
+		info := handlers.RouteInfo{Path: incomingURL.Path, Prefix: prefix, HandlerType: handlerType, BackendID: backendID}
+		mux.Handle(incomingURL.Path, prefix, handlers.NewRouteInfoHandler(info, handlers.NewTracingHandler(handlerType, handler)))
+	}
+
 	// Map the route to a handler
-	switch route.handlerType() {
+	switch handlerType {
 	case HandlerTypeBackend:
-		backend := route.backend()
-		if backend == nil {
-			logger.Warn().Str("incoming_path", *route.IncomingPath).Msg("ignoring route with nil backend_id")
+		backend, handler, ok := backendHandler(route, backends, logger)
+		if !ok {
 			return nil
 		}
-		handler, ok := backends[*backend]
+		if handlers.ResponseCache != nil && route.cacheEnabled() {
+			handler = handlers.NewCachingHandler(backend, handler)
+		}
+		handle(backend, handlers.NewBackendSecurityHeadersHandler(backend, handler))
+	case HandlerTypeRewrite:
+		backend, handler, ok := backendHandler(route, backends, logger)
 		if !ok {
-			logger.Warn().Str("incoming_path", *route.IncomingPath).Str("backend_id", *backend).Msg("ignoring route with unknown backend")
 			return nil
 		}
-		mux.Handle(incomingURL.Path, prefix, handler)
+		handler, err := handlers.NewRewriteHandler(backend, incomingURL.Path, *route.RewriteTo, prefix, handler)
+		if err != nil {
+			logger.Warn().Err(err).Str("incoming_path", *route.IncomingPath).Msg("ignoring route with invalid rewrite_to")
+			return nil //nolint:nilerr
+		}
+		// Responses are cached by the incoming path, so that they can be purged by it
+		if handlers.ResponseCache != nil && route.cacheEnabled() {
+			handler = handlers.NewCachingHandler(backend, handler)
+		}
+		handle(backend, handlers.NewBackendSecurityHeadersHandler(backend, handler))
 	case HandlerTypeRedirect:
 		if route.RedirectTo == nil {
 			logger.Warn().Str("incoming_path", *route.IncomingPath).Msg("ignoring route with nil redirect_to")
 			return nil
 		}
-		handler := handlers.NewRedirectHandler(incomingURL.Path, *route.RedirectTo, shouldPreserveSegments(*route.RouteType, route.segmentsMode()), logger)
-		mux.Handle(incomingURL.Path, prefix, handler)
+		code := route.redirectCode()
+		if !handlers.IsRedirectCode(code) {
+			logger.Warn().Str("incoming_path", *route.IncomingPath).Int("redirect_code", code).Msg("ignoring route with invalid redirect_code")
+			return nil
+		}
+		queryPolicy := route.queryPolicy()
+		if !handlers.IsQueryPolicy(queryPolicy) {
+			logger.Warn().Str("incoming_path", *route.IncomingPath).Str("query_policy", queryPolicy).Msg("ignoring route with invalid query_policy")
+			return nil
+		}
+		handler := handlers.NewRedirectHandler(
+			incomingURL.Path,
+			*route.RedirectTo,
+			shouldPreserveSegments(*route.RouteType, route.segmentsMode()),
+			code,
+			route.redirectCacheDuration(handlers.RedirectCacheDuration),
+			queryPolicy,
+			logger,
+		)
+		handle("", handler)
 	case HandlerTypeGone:
-		mux.Handle(incomingURL.Path, prefix, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			http.Error(w, "410 Gone", http.StatusGone)
-		}))
+		handle("", handlers.NewGoneHandler(route.goneDetails()))
+	case HandlerTypeStatic:
+		response, err := route.staticResponse()
+		if err != nil {
+			logger.Warn().Err(err).Str("incoming_path", *route.IncomingPath).Msg("ignoring route with unparseable response")
+			return nil //nolint:nilerr
+		}
+		handler, err := handlers.NewStaticHandler(incomingURL.Path, prefix, response)
+		if err != nil {
+			logger.Warn().Err(err).Str("incoming_path", *route.IncomingPath).Msg("ignoring route with invalid response")
+			return nil //nolint:nilerr
+		}
+		handle("", handler)
 	default:
-		logger.Warn().Interface("route", route).Str("handler_type", route.handlerType()).Msg("ignoring route with unknown handler type")
+		logger.Warn().Interface("route", route).Str("handler_type", handlerType).Msg("ignoring route with unknown handler type")
 		return nil
 	}
 	return nil
 }
 
+// Returns the ID and handler of the backend for a route, with the route's header rules, or false if it
+// doesn't have a known backend or valid header rules
+func backendHandler(route *Route, backends map[string]http.Handler, logger zerolog.Logger) (string, http.Handler, bool) {
+	backend := route.backend()
+	if backend == nil {
+		logger.Warn().Str("incoming_path", *route.IncomingPath).Msg("ignoring route with nil backend_id")
+		return "", nil, false
+	}
+	handler, ok := backends[*backend]
+	if !ok {
+		logger.Warn().Str("incoming_path", *route.IncomingPath).Str("backend_id", *backend).Msg("ignoring route with unknown backend")
+		return "", nil, false
+	}
+	rules, err := route.headerRules()
+	if err == nil && rules != nil {
+		handler, err = handlers.NewHeaderRulesHandler(*rules, handler)
+	}
+	if err != nil {
+		logger.Warn().Err(err).Str("incoming_path", *route.IncomingPath).Msg("ignoring route with invalid header_rules")
+		return "", nil, false
+	}
+	return *backend, handler, true
+}
+
 // Routes are loaded from content-store and mapped to handlers
 func loadRoutes(pool PgxIface, mux *triemux.Mux, backends map[string]http.Handler, logger zerolog.Logger) error {
 	rows, err := pool.Query(context.Background(), loadRoutesQuery)
@@ -88,40 +163,103 @@ func loadRoutes(pool PgxIface, mux *triemux.Mux, backends map[string]http.Handle
 	}
 	defer rows.Close()
 
+	var routes []*Route
 	for rows.Next() {
-		route := &Route{}
-		scans := []any{
-			&route.BackendID,
-			&route.IncomingPath,
-			&route.RouteType,
-			&route.RedirectTo,
-			&route.SegmentsMode,
-			&route.SchemaName,
-			&route.Details,
-		}
-
-		err := rows.Scan(scans...)
-		if err != nil {
+		row := &routeRow{}
+		if err := row.scan(rows); err != nil {
 			return err
 		}
-
-		// Routes are mapped to handlers and added to the triemux
-		err = addHandler(mux, route, backends, logger)
+		route, err := row.route()
 		if err != nil {
-			return err
+			logger.Warn().Err(err).Interface("incoming_path", row.IncomingPath).Msg("ignoring route with invalid field")
+			continue
 		}
+		routes = append(routes, route)
 	}
 
 	if err := rows.Err(); err != nil {
 		return err
 	}
 
-	err = addProbeRoutes(mux, backends, logger)
-	if err != nil {
-		return err
+	return addRoutes(mux, routes, backends, logger)
+}
+
+// routeRow is a row of loadRoutesQuery. Fields which aren't strings in the
+// JSON of content-store's routes are selected as text and parsed by route, so
+// that an invalid value only stops its own route from loading rather than
+// failing the whole query.
+type routeRow struct {
+	Route
+	redirectCode   *string
+	redirectMaxAge *string
+	cache          *string
+}
+
+func (row *routeRow) scan(rows pgx.Rows) error {
+	return rows.Scan(
+		&row.BackendID,
+		&row.IncomingPath,
+		&row.RouteType,
+		&row.RedirectTo,
+		&row.SegmentsMode,
+		&row.redirectCode,
+		&row.redirectMaxAge,
+		&row.QueryPolicy,
+		&row.SchemaName,
+		&row.Details,
+		&row.cache,
+		&row.Response,
+		&row.RewriteTo,
+		&row.HeaderRules,
+	)
+}
+
+// Returns the route in the row, or an error if one of its fields is invalid
+func (row *routeRow) route() (*Route, error) {
+	route := row.Route
+	if row.redirectCode != nil {
+		code, err := strconv.Atoi(*row.redirectCode)
+		if err != nil {
+			return nil, fmt.Errorf("invalid redirect_code %q", *row.redirectCode)
+		}
+		route.RedirectCode = &code
+	}
+	if row.redirectMaxAge != nil {
+		maxAge, err := strconv.Atoi(*row.redirectMaxAge)
+		if err != nil {
+			return nil, fmt.Errorf("invalid redirect_max_age %q", *row.redirectMaxAge)
+		}
+		route.RedirectMaxAge = &maxAge
+	}
+	if row.cache != nil {
+		cache, err := strconv.ParseBool(*row.cache)
+		if err != nil {
+			return nil, fmt.Errorf("invalid cache %q", *row.cache)
+		}
+		route.Cache = &cache
 	}
+	return &route, nil
+}
 
-	return nil
+// Redirect chains are flattened, then routes are mapped to handlers and added
+// to the triemux. The targets of redirects are looked up in the triemux
+// before the probe routes are added.
+func addRoutes(mux *triemux.Mux, routes []*Route, backends map[string]http.Handler, logger zerolog.Logger) error {
+	loaded := make([]*Route, 0, len(routes))
+	for _, route := range flattenRedirects(routes, logger) {
+		count := mux.RouteCount()
+		err := addHandler(mux, route, backends, logger)
+		if err != nil {
+			return err
+		}
+		if mux.RouteCount() > count {
+			loaded = append(loaded, route)
+		}
+	}
+
+	checkRedirectTargets(mux, loaded, logger)
+
+	return addProbeRoutes(mux, backends, logger)
 }
 
 func addProbeRoutes(mux *triemux.Mux, backends map[string]http.Handler, logger zerolog.Logger) error {
@@ -28,6 +28,8 @@ func loadRoutesFromFile(filePath string, mux *triemux.Mux, backends map[string]h
 	scanner := bufio.NewScanner(file)
 	lineNum := 0
 
+	var routes []*Route
+
 	for scanner.Scan() {
 		lineNum++
 		line := scanner.Text()
@@ -47,18 +49,15 @@ func loadRoutesFromFile(filePath string, mux *triemux.Mux, backends map[string]h
 			continue
 		}
 
-		if err := addHandler(mux, route, backends, logger); err != nil {
-			return fmt.Errorf("failed to add handler at line %d: %w", lineNum, err)
-		}
+		routes = append(routes, route)
 	}
 
 	if err := scanner.Err(); err != nil {
 		return fmt.Errorf("error reading routes file: %w", err)
 	}
 
-	err = addProbeRoutes(mux, backends, logger)
-	if err != nil {
-		return err
+	if err := addRoutes(mux, routes, backends, logger); err != nil {
+		return fmt.Errorf("failed to add handlers: %w", err)
 	}
 
 	return nil
@@ -261,3 +261,70 @@ func TestLoadRoutesFromFile_EmptyLines(t *testing.T) {
 		t.Errorf("Expected 4 routes (skipping empty lines), got %d", routeCount)
 	}
 }
+
+func TestLoadRoutesFromFile_RedirectCode(t *testing.T) {
+	tmpDir := t.TempDir()
+	routesFile := filepath.Join(tmpDir, "redirect_routes.jsonl")
+
+	content := `{"BackendID":null,"IncomingPath":"/campaign","RouteType":"exact","RedirectTo":"/landing-page","SegmentsMode":"ignore","RedirectCode":302,"SchemaName":"redirect","Details":null}
+`
+
+	if err := os.WriteFile(routesFile, []byte(content), 0600); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+
+	logger := zerolog.Nop()
+	mux := triemux.NewMux(logger)
+
+	err := loadRoutesFromFile(routesFile, mux, map[string]http.Handler{}, logger)
+	if err != nil {
+		t.Fatalf("Failed to load routes from file: %v", err)
+	}
+
+	req, _ := http.NewRequestWithContext(context.Background(), http.MethodGet, "/campaign", nil)
+	rr := httptest.NewRecorder()
+	mux.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusFound {
+		t.Errorf("Expected /campaign to return HTTP Code 302, got %v", rr.Code)
+	}
+}
+
+func TestLoadRoutesFromFile_RedirectChains(t *testing.T) {
+	tmpDir := t.TempDir()
+	routesFile := filepath.Join(tmpDir, "redirect_chain_routes.jsonl")
+
+	content := `{"BackendID":null,"IncomingPath":"/first","RouteType":"exact","RedirectTo":"/second","SegmentsMode":"ignore","SchemaName":"redirect","Details":null}
+{"BackendID":null,"IncomingPath":"/second","RouteType":"exact","RedirectTo":"/third","SegmentsMode":"ignore","SchemaName":"redirect","Details":null}
+{"BackendID":null,"IncomingPath":"/loop-a","RouteType":"exact","RedirectTo":"/loop-b","SegmentsMode":"ignore","SchemaName":"redirect","Details":null}
+{"BackendID":null,"IncomingPath":"/loop-b","RouteType":"exact","RedirectTo":"/loop-a","SegmentsMode":"ignore","SchemaName":"redirect","Details":null}
+`
+
+	if err := os.WriteFile(routesFile, []byte(content), 0600); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+
+	logger := zerolog.Nop()
+	mux := triemux.NewMux(logger)
+
+	err := loadRoutesFromFile(routesFile, mux, map[string]http.Handler{}, logger)
+	if err != nil {
+		t.Fatalf("Failed to load routes from file: %v", err)
+	}
+
+	req, _ := http.NewRequestWithContext(context.Background(), http.MethodGet, "/first", nil)
+	rr := httptest.NewRecorder()
+	mux.ServeHTTP(rr, req)
+
+	if location := rr.Header().Get("Location"); location != "/third" {
+		t.Errorf("Expected /first to redirect straight to /third, got %q", location)
+	}
+
+	req, _ = http.NewRequestWithContext(context.Background(), http.MethodGet, "/loop-a", nil)
+	rr = httptest.NewRecorder()
+	mux.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusNotFound {
+		t.Errorf("Expected /loop-a to return HTTP Code 404, got %v", rr.Code)
+	}
+}
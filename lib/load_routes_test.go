@@ -1,12 +1,17 @@
 package router
 
 import (
+	"bytes"
+	"encoding/json"
 	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
 	"os"
 	"sync"
+	"time"
 
+	"github.com/alphagov/router/handlers"
 	"github.com/alphagov/router/triemux"
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
@@ -64,9 +69,9 @@ var _ = Describe("loadRoutes", func() {
 
 	Context("when content store has backend routes", func() {
 		BeforeEach(func() {
-			rows := pgxmock.NewRows([]string{"backend", "path", "match_type", "destination", "segments_mode", "schema_name", "details"}).
-				AddRow(new("backend1"), new("/path1"), new("exact"), nil, nil, new("guidance"), new("")).
-				AddRow(new("backend2"), new("/path2"), new("prefix"), nil, nil, new("guidance"), new(""))
+			rows := pgxmock.NewRows([]string{"backend", "path", "match_type", "destination", "segments_mode", "redirect_code", "redirect_max_age", "query_policy", "schema_name", "details", "cache", "response", "rewrite_to", "header_rules"}).
+				AddRow(new("backend1"), new("/path1"), new("exact"), nil, nil, nil, nil, nil, new("guidance"), new(""), nil, nil, nil, nil).
+				AddRow(new("backend2"), new("/path2"), new("prefix"), nil, nil, nil, nil, nil, new("guidance"), new(""), nil, nil, nil, nil)
 
 			mockPool.ExpectQuery("WITH").WillReturnRows(rows)
 
@@ -95,8 +100,8 @@ var _ = Describe("loadRoutes", func() {
 
 	Context("when a route has an unparseable IncomingPath", func() {
 		It("should not load the route", func() {
-			rows := pgxmock.NewRows([]string{"backend", "path", "match_type", "destination", "segments_mode", "schema_name", "details"}).
-				AddRow(nil, new("\n"), new("exact"), nil, nil, new("gone"), new(""))
+			rows := pgxmock.NewRows([]string{"backend", "path", "match_type", "destination", "segments_mode", "redirect_code", "redirect_max_age", "query_policy", "schema_name", "details", "cache", "response", "rewrite_to", "header_rules"}).
+				AddRow(nil, new("\n"), new("exact"), nil, nil, nil, nil, nil, new("gone"), new(""), nil, nil, nil, nil)
 
 			mockPool.ExpectQuery("WITH").WillReturnRows(rows)
 
@@ -107,9 +112,9 @@ var _ = Describe("loadRoutes", func() {
 		})
 
 		It("should not fail to load other routes", func() {
-			rows := pgxmock.NewRows([]string{"backend", "path", "match_type", "destination", "segments_mode", "schema_name", "details"}).
-				AddRow(nil, new("\n"), new("exact"), nil, nil, new("gone"), new("")).
-				AddRow(nil, new("/frontend-gone"), new("exact"), nil, nil, new("gone"), new("{\"explanation\": \"this is gone\", \"alternative_path\": null}"))
+			rows := pgxmock.NewRows([]string{"backend", "path", "match_type", "destination", "segments_mode", "redirect_code", "redirect_max_age", "query_policy", "schema_name", "details", "cache", "response", "rewrite_to", "header_rules"}).
+				AddRow(nil, new("\n"), new("exact"), nil, nil, nil, nil, nil, new("gone"), new(""), nil, nil, nil, nil).
+				AddRow(nil, new("/frontend-gone"), new("exact"), nil, nil, nil, nil, nil, new("gone"), new("{\"explanation\": \"this is gone\", \"alternative_path\": null}"), nil, nil, nil, nil)
 
 			mockPool.ExpectQuery("WITH").WillReturnRows(rows)
 
@@ -121,13 +126,13 @@ var _ = Describe("loadRoutes", func() {
 
 	Context("when content store has gone routes", func() {
 		BeforeEach(func() {
-			rows := pgxmock.NewRows([]string{"backend", "path", "match_type", "destination", "segments_mode", "schema_name", "details"}).
-				AddRow(nil, new("/frontend-gone"), new("exact"), nil, nil, new("gone"), new("{\"explanation\": \"this is gone\", \"alternative_path\": null}")).
-				AddRow(new("backend2"), new("/backend-gone"), new("exact"), nil, nil, new("gone"), new("{\"explanation\": \"this is gone\", \"alternative_path\": null}")).
-				AddRow(new("backend1"), new("/guidance"), new("exact"), nil, nil, new("guidance"), new("")).
-				AddRow(nil, new("/gone-empty-attributes"), new("exact"), nil, nil, new("gone"), new("{\"explanation\": null, \"alternative_path\": null}")).
-				AddRow(nil, new("/gone-empty-details"), new("exact"), nil, nil, new("gone"), new("{}")).
-				AddRow(nil, new("/gone-nil-details"), new("exact"), nil, nil, new("gone"), nil)
+			rows := pgxmock.NewRows([]string{"backend", "path", "match_type", "destination", "segments_mode", "redirect_code", "redirect_max_age", "query_policy", "schema_name", "details", "cache", "response", "rewrite_to", "header_rules"}).
+				AddRow(nil, new("/frontend-gone"), new("exact"), nil, nil, nil, nil, nil, new("gone"), new("{\"explanation\": \"this is gone\", \"alternative_path\": null}"), nil, nil, nil, nil).
+				AddRow(new("backend2"), new("/backend-gone"), new("exact"), nil, nil, nil, nil, nil, new("gone"), new("{\"explanation\": \"this is gone\", \"alternative_path\": null}"), nil, nil, nil, nil).
+				AddRow(new("backend1"), new("/guidance"), new("exact"), nil, nil, nil, nil, nil, new("guidance"), new(""), nil, nil, nil, nil).
+				AddRow(nil, new("/gone-empty-attributes"), new("exact"), nil, nil, nil, nil, nil, new("gone"), new("{\"explanation\": null, \"alternative_path\": null}"), nil, nil, nil, nil).
+				AddRow(nil, new("/gone-empty-details"), new("exact"), nil, nil, nil, nil, nil, new("gone"), new("{}"), nil, nil, nil, nil).
+				AddRow(nil, new("/gone-nil-details"), new("exact"), nil, nil, nil, nil, nil, new("gone"), nil, nil, nil, nil, nil)
 
 			mockPool.ExpectQuery("WITH").WillReturnRows(rows)
 
@@ -178,15 +183,60 @@ var _ = Describe("loadRoutes", func() {
 		})
 	})
 
+	Context("when Router renders gone pages itself", func() {
+		BeforeEach(func() {
+			handlers.RenderGonePages = true
+
+			rows := pgxmock.NewRows([]string{"backend", "path", "match_type", "destination", "segments_mode", "redirect_code", "redirect_max_age", "query_policy", "schema_name", "details", "cache", "response", "rewrite_to", "header_rules"}).
+				AddRow(new("backend2"), new("/backend-gone"), new("exact"), nil, nil, nil, nil, nil, new("gone"), new("{\"explanation\": \"this is gone\", \"alternative_path\": \"/replacement\"}"), nil, nil, nil, nil).
+				AddRow(nil, new("/gone-nil-details"), new("exact"), nil, nil, nil, nil, nil, new("gone"), nil, nil, nil, nil, nil)
+			mockPool.ExpectQuery("WITH").WillReturnRows(rows)
+
+			err := loadRoutes(mockPool, mux, backends, logger)
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		AfterEach(func() {
+			handlers.RenderGonePages = false
+		})
+
+		It("should render the page for gone route with description", func() {
+			req, _ := http.NewRequest(http.MethodGet, "/backend-gone", nil)
+			rr := httptest.NewRecorder()
+			mux.ServeHTTP(rr, req)
+
+			Expect(rr.Code).To(Equal(http.StatusGone))
+			Expect(rr.Header().Get("Link")).To(Equal(`</replacement>; rel="alternate"`))
+			Expect(rr.Body.String()).To(ContainSubstring("this is gone"))
+		})
+
+		It("should load gone route with nil description", func() {
+			req, _ := http.NewRequest(http.MethodGet, "/gone-nil-details", nil)
+			rr := httptest.NewRecorder()
+			mux.ServeHTTP(rr, req)
+
+			Expect(rr.Code).To(Equal(http.StatusGone))
+			Expect(rr.Body.String()).To(Equal("410 Gone\n"))
+		})
+	})
+
 	Context("when content store has redirect routes", func() {
 		BeforeEach(func() {
-			rows := pgxmock.NewRows([]string{"backend", "path", "match_type", "destination", "segments_mode", "schema_name", "details"}).
-				AddRow(nil, new("/redirect-exact"), new("exact"), new("/redirected-exact"), nil, new("redirect"), nil).
-				AddRow(nil, new("/redirect-prefix"), new("prefix"), new("/redirected-prefix"), nil, new("redirect"), nil).
-				AddRow(nil, new("/redirect-exact-ignore"), new("exact"), new("/redirected-exact-ignore"), new("ignore"), new("redirect"), nil).
-				AddRow(nil, new("/redirect-prefix-ignore"), new("prefix"), new("/redirected-prefix-ignore"), new("ignore"), new("redirect"), nil).
-				AddRow(nil, new("/redirect-exact-preserve"), new("exact"), new("/redirected-exact-preserve"), new("preserve"), new("redirect"), nil).
-				AddRow(nil, new("/redirect-prefix-preserve"), new("prefix"), new("/redirected-prefix-preserve"), new("preserve"), new("redirect"), nil)
+			rows := pgxmock.NewRows([]string{"backend", "path", "match_type", "destination", "segments_mode", "redirect_code", "redirect_max_age", "query_policy", "schema_name", "details", "cache", "response", "rewrite_to", "header_rules"}).
+				AddRow(nil, new("/redirect-exact"), new("exact"), new("/redirected-exact"), nil, nil, nil, nil, new("redirect"), nil, nil, nil, nil, nil).
+				AddRow(nil, new("/redirect-prefix"), new("prefix"), new("/redirected-prefix"), nil, nil, nil, nil, new("redirect"), nil, nil, nil, nil, nil).
+				AddRow(nil, new("/redirect-exact-ignore"), new("exact"), new("/redirected-exact-ignore"), new("ignore"), nil, nil, nil, new("redirect"), nil, nil, nil, nil, nil).
+				AddRow(nil, new("/redirect-prefix-ignore"), new("prefix"), new("/redirected-prefix-ignore"), new("ignore"), nil, nil, nil, new("redirect"), nil, nil, nil, nil, nil).
+				AddRow(nil, new("/redirect-exact-preserve"), new("exact"), new("/redirected-exact-preserve"), new("preserve"), nil, nil, nil, new("redirect"), nil, nil, nil, nil, nil).
+				AddRow(nil, new("/redirect-prefix-preserve"), new("prefix"), new("/redirected-prefix-preserve"), new("preserve"), nil, nil, nil, new("redirect"), nil, nil, nil, nil, nil).
+				AddRow(nil, new("/redirect-temporary"), new("exact"), new("/redirected-temporary"), nil, new("307"), nil, nil, new("redirect"), nil, nil, nil, nil, nil).
+				AddRow(nil, new("/redirect-invalid-code"), new("exact"), new("/redirected-invalid-code"), nil, new("200"), nil, nil, new("redirect"), nil, nil, nil, nil, nil).
+				AddRow(nil, new("/redirect-unparseable-code"), new("exact"), new("/redirected-unparseable-code"), nil, new("301 "), nil, nil, new("redirect"), nil, nil, nil, nil, nil).
+				AddRow(nil, new("/redirect-short-lived"), new("exact"), new("/redirected-short-lived"), nil, nil, new("60"), nil, new("redirect"), nil, nil, nil, nil, nil).
+				AddRow(nil, new("/redirect-uncached"), new("exact"), new("/redirected-uncached"), nil, nil, new("0"), nil, new("redirect"), nil, nil, nil, nil, nil).
+				AddRow(nil, new("/redirect-invalid-max-age"), new("exact"), new("/redirected-invalid-max-age"), nil, nil, new("1.5"), nil, new("redirect"), nil, nil, nil, nil, nil).
+				AddRow(nil, new("/redirect-merge"), new("exact"), new("/redirected-merge?a=1#section"), nil, nil, nil, new("merge"), new("redirect"), nil, nil, nil, nil, nil).
+				AddRow(nil, new("/redirect-invalid-query-policy"), new("exact"), new("/redirected-invalid-query-policy"), nil, nil, nil, new("keep"), new("redirect"), nil, nil, nil, nil, nil)
 			mockPool.ExpectQuery("WITH").WillReturnRows(rows)
 
 			err := loadRoutes(mockPool, mux, backends, logger)
@@ -238,6 +288,64 @@ var _ = Describe("loadRoutes", func() {
 			Expect(rr.Header().Get("Location")).To(Equal("/redirected-exact-preserve"))
 		})
 
+		It("should load redirect route with a redirect code", func() {
+			req, _ := http.NewRequest(http.MethodPost, "/redirect-temporary", nil)
+			rr := httptest.NewRecorder()
+			mux.ServeHTTP(rr, req)
+
+			Expect(rr.Code).To(Equal(http.StatusTemporaryRedirect))
+			Expect(rr.Header().Get("Location")).To(Equal("/redirected-temporary"))
+		})
+
+		It("should not load redirect route with an invalid redirect code", func() {
+			req, _ := http.NewRequest(http.MethodGet, "/redirect-invalid-code", nil)
+			rr := httptest.NewRecorder()
+			mux.ServeHTTP(rr, req)
+
+			Expect(rr.Code).To(Equal(http.StatusNotFound))
+		})
+
+		It("should not load redirect route with a redirect code that isn't a number", func() {
+			req, _ := http.NewRequest(http.MethodGet, "/redirect-unparseable-code", nil)
+			rr := httptest.NewRecorder()
+			mux.ServeHTTP(rr, req)
+
+			Expect(rr.Code).To(Equal(http.StatusNotFound))
+		})
+
+		It("should load redirect route with the default cache duration", func() {
+			req, _ := http.NewRequest(http.MethodGet, "/redirect-exact", nil)
+			rr := httptest.NewRecorder()
+			mux.ServeHTTP(rr, req)
+
+			Expect(rr.Header().Get("Cache-Control")).To(Equal("max-age=1800, public"))
+		})
+
+		It("should load redirect route with its own cache duration", func() {
+			req, _ := http.NewRequest(http.MethodGet, "/redirect-short-lived", nil)
+			rr := httptest.NewRecorder()
+			mux.ServeHTTP(rr, req)
+
+			Expect(rr.Header().Get("Cache-Control")).To(Equal("max-age=60, public"))
+		})
+
+		It("should load redirect route which must not be cached", func() {
+			req, _ := http.NewRequest(http.MethodGet, "/redirect-uncached", nil)
+			rr := httptest.NewRecorder()
+			mux.ServeHTTP(rr, req)
+
+			Expect(rr.Header().Get("Cache-Control")).To(Equal("no-store"))
+			Expect(rr.Header().Get("Expires")).To(BeEmpty())
+		})
+
+		It("should not load redirect route with a max age that isn't a whole number", func() {
+			req, _ := http.NewRequest(http.MethodGet, "/redirect-invalid-max-age", nil)
+			rr := httptest.NewRecorder()
+			mux.ServeHTTP(rr, req)
+
+			Expect(rr.Code).To(Equal(http.StatusNotFound))
+		})
+
 		It("should load prefix redirect route that preserves suffix segments", func() {
 			req, _ := http.NewRequest(http.MethodGet, "/redirect-prefix-preserve/foo/bar", nil)
 			rr := httptest.NewRecorder()
@@ -246,6 +354,294 @@ var _ = Describe("loadRoutes", func() {
 			Expect(rr.Code).To(Equal(http.StatusMovedPermanently))
 			Expect(rr.Header().Get("Location")).To(Equal("/redirected-prefix-preserve/foo/bar"))
 		})
+
+		It("should load redirect route with a query policy", func() {
+			req, _ := http.NewRequest(http.MethodGet, "/redirect-merge?b=2", nil)
+			rr := httptest.NewRecorder()
+			mux.ServeHTTP(rr, req)
+
+			Expect(rr.Code).To(Equal(http.StatusMovedPermanently))
+			Expect(rr.Header().Get("Location")).To(Equal("/redirected-merge?a=1&b=2#section"))
+		})
+
+		It("should not load redirect route with an invalid query policy", func() {
+			req, _ := http.NewRequest(http.MethodGet, "/redirect-invalid-query-policy", nil)
+			rr := httptest.NewRecorder()
+			mux.ServeHTTP(rr, req)
+
+			Expect(rr.Code).To(Equal(http.StatusNotFound))
+		})
+	})
+
+	Context("when content store has static routes", func() {
+		BeforeEach(func() {
+			rows := pgxmock.NewRows([]string{"backend", "path", "match_type", "destination", "segments_mode", "redirect_code", "redirect_max_age", "query_policy", "schema_name", "details", "cache", "response", "rewrite_to", "header_rules"}).
+				AddRow(new("backend1"), new("/robots.txt"), new("exact"), nil, nil, nil, nil, nil, new("special_route"), nil, nil, new(`{"body": "User-agent: *\n"}`), nil, nil).
+				AddRow(nil, new("/maintenance"), new("prefix"), nil, nil, nil, nil, nil, nil, nil, nil, new(`{"status": 503, "content_type": "text/html", "headers": {"Retry-After": "60"}, "body": "<h1>Down</h1>"}`), nil, nil).
+				AddRow(nil, new("/invalid-status"), new("exact"), nil, nil, nil, nil, nil, nil, nil, nil, new(`{"status": 42}`), nil, nil).
+				AddRow(nil, new("/invalid-json"), new("exact"), nil, nil, nil, nil, nil, nil, nil, nil, new(`{"status": `), nil, nil).
+				AddRow(nil, new("/no-static-files-dir"), new("exact"), nil, nil, nil, nil, nil, nil, nil, nil, new(`{"file": "robots.txt"}`), nil, nil)
+			mockPool.ExpectQuery("WITH").WillReturnRows(rows)
+
+			err := loadRoutes(mockPool, mux, backends, logger)
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		It("should serve the response of a static route", func() {
+			req, _ := http.NewRequest(http.MethodGet, "/robots.txt", nil)
+			rr := httptest.NewRecorder()
+			mux.ServeHTTP(rr, req)
+
+			Expect(rr.Code).To(Equal(http.StatusOK))
+			Expect(rr.Body.String()).To(Equal("User-agent: *\n"))
+		})
+
+		It("should serve the response of a static prefix route", func() {
+			req, _ := http.NewRequest(http.MethodGet, "/maintenance/foo", nil)
+			rr := httptest.NewRecorder()
+			mux.ServeHTTP(rr, req)
+
+			Expect(rr.Code).To(Equal(http.StatusServiceUnavailable))
+			Expect(rr.Header().Get("Content-Type")).To(Equal("text/html"))
+			Expect(rr.Header().Get("Retry-After")).To(Equal("60"))
+			Expect(rr.Body.String()).To(Equal("<h1>Down</h1>"))
+		})
+
+		DescribeTable("should not load static routes with an invalid response",
+			func(path string) {
+				req, _ := http.NewRequest(http.MethodGet, path, nil)
+				rr := httptest.NewRecorder()
+				mux.ServeHTTP(rr, req)
+
+				Expect(rr.Code).To(Equal(http.StatusNotFound))
+			},
+			Entry("invalid status", "/invalid-status"),
+			Entry("invalid JSON", "/invalid-json"),
+			Entry("file without a static files directory", "/no-static-files-dir"),
+		)
+	})
+
+	Context("when content store has rewrite routes", func() {
+		BeforeEach(func() {
+			backends["collections"] = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusOK)
+				if _, err := w.Write([]byte("collections " + r.URL.Path)); err != nil {
+					fmt.Println("Failed to write to the response", err)
+				}
+			})
+
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("X-Debug", "debug")
+				w.WriteHeader(http.StatusOK)
+				if _, err := w.Write([]byte("collections " + r.URL.Path + " " + r.Header.Get("X-Route"))); err != nil {
+					fmt.Println("Failed to write to the response", err)
+				}
+			}))
+			DeferCleanup(server.Close)
+			serverURL, err := url.Parse(server.URL)
+			Expect(err).NotTo(HaveOccurred())
+			backends["collections-proxy"] = handlers.NewBackendHandler("collections-proxy", serverURL, time.Second, time.Second, logger)
+
+			rows := pgxmock.NewRows([]string{"backend", "path", "match_type", "destination", "segments_mode", "redirect_code", "redirect_max_age", "query_policy", "schema_name", "details", "cache", "response", "rewrite_to", "header_rules"}).
+				AddRow(new("collections"), new("/browse/benefits"), new("prefix"), nil, nil, nil, nil, nil, new("mainstream_browse_page"), nil, nil, nil, new("/topics/benefits"), nil).
+				AddRow(new("collections"), new("/browse/invalid"), new("exact"), nil, nil, nil, nil, nil, new("mainstream_browse_page"), nil, nil, nil, new("https://www.gov.uk/topics"), nil).
+				AddRow(new("collections-proxy"), new("/browse/headers"), new("exact"), nil, nil, nil, nil, nil, new("mainstream_browse_page"), nil, nil, nil, new("/topics/headers"), new(`{"request": [{"op": "set", "name": "X-Route", "value": "browse"}], "response": [{"op": "remove", "name": "X-Debug"}]}`)).
+				AddRow(new("collections"), new("/browse/invalid-headers"), new("exact"), nil, nil, nil, nil, nil, new("mainstream_browse_page"), nil, nil, nil, new("/topics/headers"), new(`{"request": [{"op": "delete", "name": "X-Route"}]}`)).
+				AddRow(new("unknown"), new("/browse/unknown"), new("exact"), nil, nil, nil, nil, nil, new("mainstream_browse_page"), nil, nil, nil, new("/topics/unknown"), nil)
+			mockPool.ExpectQuery("WITH").WillReturnRows(rows)
+
+			err = loadRoutes(mockPool, mux, backends, logger)
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		It("should send requests for rewrite routes to the backend with the rewritten path", func() {
+			req, _ := http.NewRequest(http.MethodGet, "/browse/benefits/child-benefit", nil)
+			rr := httptest.NewRecorder()
+			mux.ServeHTTP(rr, req)
+
+			Expect(rr.Code).To(Equal(http.StatusOK))
+			Expect(rr.Body.String()).To(Equal("collections /topics/benefits/child-benefit"))
+		})
+
+		It("should not load rewrite routes with an invalid rewrite_to", func() {
+			req, _ := http.NewRequest(http.MethodGet, "/browse/invalid", nil)
+			rr := httptest.NewRecorder()
+			mux.ServeHTTP(rr, req)
+
+			Expect(rr.Code).To(Equal(http.StatusNotFound))
+		})
+
+		It("should pass the header rules of rewrite routes to the backend", func() {
+			req, _ := http.NewRequest(http.MethodGet, "/browse/headers", nil)
+			rr := httptest.NewRecorder()
+			mux.ServeHTTP(rr, req)
+
+			Expect(rr.Code).To(Equal(http.StatusOK))
+			Expect(rr.Header().Get("X-Debug")).To(BeEmpty())
+			Expect(rr.Body.String()).To(Equal("collections /topics/headers browse"))
+		})
+
+		It("should not load rewrite routes with invalid header rules", func() {
+			req, _ := http.NewRequest(http.MethodGet, "/browse/invalid-headers", nil)
+			rr := httptest.NewRecorder()
+			mux.ServeHTTP(rr, req)
+
+			Expect(rr.Code).To(Equal(http.StatusNotFound))
+		})
+
+		It("should not load rewrite routes with an unknown backend", func() {
+			req, _ := http.NewRequest(http.MethodGet, "/browse/unknown", nil)
+			rr := httptest.NewRecorder()
+			mux.ServeHTTP(rr, req)
+
+			Expect(rr.Code).To(Equal(http.StatusNotFound))
+		})
+	})
+
+	Context("when there is a security header policy", func() {
+		var router *Router
+
+		BeforeEach(func() {
+			handlers.SecurityHeaders = &handlers.SecurityHeaderPolicy{
+				Headers: map[string]string{"X-Content-Type-Options": "nosniff", "Referrer-Policy": "strict-origin"},
+				Backends: map[string]handlers.BackendSecurityHeaders{
+					"backend1": {Headers: map[string]string{"Referrer-Policy": "no-referrer"}},
+				},
+			}
+
+			rows := pgxmock.NewRows([]string{"backend", "path", "match_type", "destination", "segments_mode", "redirect_code", "redirect_max_age", "query_policy", "schema_name", "details", "cache", "response", "rewrite_to", "header_rules"}).
+				AddRow(new("backend1"), new("/backend"), new("exact"), nil, nil, nil, nil, nil, new("guidance"), nil, nil, nil, nil, nil).
+				AddRow(nil, new("/redirect"), new("exact"), new("/backend"), nil, nil, nil, nil, new("redirect"), nil, nil, nil, nil, nil)
+			mockPool.ExpectQuery("WITH").WillReturnRows(rows)
+
+			err := loadRoutes(mockPool, mux, backends, logger)
+			Expect(err).NotTo(HaveOccurred())
+			router = &Router{mux: mux, Logger: logger}
+		})
+
+		AfterEach(func() {
+			handlers.SecurityHeaders = nil
+		})
+
+		DescribeTable("should add the security headers to responses",
+			func(path string, expectedCode int, expectedReferrerPolicy string) {
+				req, _ := http.NewRequest(http.MethodGet, path, nil)
+				rr := httptest.NewRecorder()
+				router.ServeHTTP(rr, req)
+
+				Expect(rr.Code).To(Equal(expectedCode))
+				Expect(rr.Header().Get("X-Content-Type-Options")).To(Equal("nosniff"))
+				Expect(rr.Header().Get("Referrer-Policy")).To(Equal(expectedReferrerPolicy))
+			},
+			Entry("backend route", "/backend", http.StatusOK, "no-referrer"),
+			Entry("redirect route", "/redirect", http.StatusMovedPermanently, "strict-origin"),
+			Entry("unknown route", "/unknown", http.StatusNotFound, "strict-origin"),
+		)
+	})
+
+	Context("when there is an access log", func() {
+		var (
+			router *Router
+			out    *bytes.Buffer
+		)
+
+		BeforeEach(func() {
+			out = &bytes.Buffer{}
+			accessLog, err := handlers.NewAccessLog(out, handlers.AccessLogFormatJSON, 1, "")
+			Expect(err).NotTo(HaveOccurred())
+			handlers.AccessLogger = accessLog
+
+			backends["panicking"] = http.HandlerFunc(func(http.ResponseWriter, *http.Request) {
+				panic("backend handler panicked")
+			})
+
+			rows := pgxmock.NewRows([]string{"backend", "path", "match_type", "destination", "segments_mode", "redirect_code", "redirect_max_age", "query_policy", "schema_name", "details", "cache", "response", "rewrite_to", "header_rules"}).
+				AddRow(new("backend1"), new("/backend"), new("prefix"), nil, nil, nil, nil, nil, new("guidance"), nil, nil, nil, nil, nil).
+				AddRow(nil, new("/redirect"), new("exact"), new("/backend"), nil, nil, nil, nil, new("redirect"), nil, nil, nil, nil, nil).
+				AddRow(new("panicking"), new("/panic"), new("exact"), nil, nil, nil, nil, nil, new("guidance"), nil, nil, nil, nil, nil)
+			mockPool.ExpectQuery("WITH").WillReturnRows(rows)
+
+			err = loadRoutes(mockPool, mux, backends, logger)
+			Expect(err).NotTo(HaveOccurred())
+			router = &Router{mux: mux, Logger: logger}
+		})
+
+		AfterEach(func() {
+			handlers.AccessLogger = nil
+		})
+
+		DescribeTable("should log the route that served each request",
+			func(path string, expectedStatus int, expectedRoute, expectedHandlerType, expectedBackendID string) {
+				req, _ := http.NewRequest(http.MethodGet, path, nil)
+				rr := httptest.NewRecorder()
+				router.ServeHTTP(rr, req)
+
+				var line map[string]any
+				Expect(json.Unmarshal(out.Bytes(), &line)).To(Succeed())
+				Expect(line).To(HaveKeyWithValue("path", path))
+				Expect(line).To(HaveKeyWithValue("status", float64(expectedStatus)))
+				Expect(line).To(HaveKeyWithValue("route", expectedRoute))
+				Expect(line).To(HaveKeyWithValue("handler_type", expectedHandlerType))
+				Expect(line).To(HaveKeyWithValue("backend_id", expectedBackendID))
+				Expect(line).To(HaveKeyWithValue("request_id", rr.Header().Get(handlers.RequestIDHeader)))
+			},
+			Entry("backend route", "/backend/page", http.StatusOK, "/backend", HandlerTypeBackend, "backend1"),
+			Entry("redirect route", "/redirect", http.StatusMovedPermanently, "/redirect", HandlerTypeRedirect, ""),
+			Entry("unknown route", "/unknown", http.StatusNotFound, "", "", ""),
+			Entry("panicking handler", "/panic", http.StatusInternalServerError, "/panic", HandlerTypeBackend, "panicking"),
+		)
+	})
+
+	Context("when the response cache is enabled", func() {
+		var requestCount int
+
+		BeforeEach(func() {
+			requestCount = 0
+			backends["backend1"] = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				requestCount++
+				w.Header().Set("Cache-Control", "max-age=60")
+				w.WriteHeader(http.StatusOK)
+			})
+			handlers.ResponseCache = handlers.NewResponseStore(1 << 20)
+
+			rows := pgxmock.NewRows([]string{"backend", "path", "match_type", "destination", "segments_mode", "redirect_code", "redirect_max_age", "query_policy", "schema_name", "details", "cache", "response", "rewrite_to", "header_rules"}).
+				AddRow(new("backend1"), new("/cached"), new("exact"), nil, nil, nil, nil, nil, new("guidance"), new(""), nil, nil, nil, nil).
+				AddRow(new("backend1"), new("/uncached"), new("exact"), nil, nil, nil, nil, nil, new("guidance"), new(""), new("false"), nil, nil, nil).
+				AddRow(new("backend1"), new("/invalid-cache"), new("exact"), nil, nil, nil, nil, nil, new("guidance"), new(""), new("no"), nil, nil, nil)
+
+			mockPool.ExpectQuery("WITH").WillReturnRows(rows)
+
+			err := loadRoutes(mockPool, mux, backends, logger)
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		AfterEach(func() {
+			handlers.ResponseCache = nil
+		})
+
+		It("should cache responses for routes by default", func() {
+			for range 2 {
+				req, _ := http.NewRequest(http.MethodGet, "/cached", nil)
+				mux.ServeHTTP(httptest.NewRecorder(), req)
+			}
+			Expect(requestCount).To(Equal(1))
+		})
+
+		It("should not cache responses for routes with caching turned off", func() {
+			for range 2 {
+				req, _ := http.NewRequest(http.MethodGet, "/uncached", nil)
+				mux.ServeHTTP(httptest.NewRecorder(), req)
+			}
+			Expect(requestCount).To(Equal(2))
+		})
+
+		It("should skip only routes with an invalid cache value", func() {
+			req, _ := http.NewRequest(http.MethodGet, "/invalid-cache", nil)
+			rr := httptest.NewRecorder()
+			mux.ServeHTTP(rr, req)
+			Expect(rr.Code).To(Equal(http.StatusNotFound))
+			Expect(mux.RouteCount()).To(Equal(2 + 3))
+		})
 	})
 
 	Context("loading the probe routes routes", func() {
@@ -280,8 +676,8 @@ var _ = Describe("loadRoutes", func() {
 		Context("when there are other routes loaded", func() {
 			BeforeEach(func() {
 				rows := pgxmock.
-					NewRows([]string{"backend", "path", "match_type", "destination", "segments_mode", "schema_name", "details"}).
-					AddRow(nil, new("/foo-gone"), new("exact"), nil, nil, new("gone"), new("{\"explanation\": \"this is gone\", \"alternative_path\": null}"))
+					NewRows([]string{"backend", "path", "match_type", "destination", "segments_mode", "redirect_code", "redirect_max_age", "query_policy", "schema_name", "details", "cache", "response", "rewrite_to", "header_rules"}).
+					AddRow(nil, new("/foo-gone"), new("exact"), nil, nil, nil, nil, nil, new("gone"), new("{\"explanation\": \"this is gone\", \"alternative_path\": null}"), nil, nil, nil, nil)
 
 				mockPool.ExpectQuery("WITH").WillReturnRows(rows)
 
@@ -349,9 +745,9 @@ var _ = Describe("Router", func() {
 		})
 
 		It("should reload routes from content store successfully", func() {
-			rows := pgxmock.NewRows([]string{"backend", "path", "match_type", "destination", "segments_mode", "schema_name", "details"}).
-				AddRow(new("backend1"), new("/path1"), new("exact"), nil, nil, new("guidance"), new("")).
-				AddRow(new("backend2"), new("/path2"), new("prefix"), nil, nil, new("guidance"), new(""))
+			rows := pgxmock.NewRows([]string{"backend", "path", "match_type", "destination", "segments_mode", "redirect_code", "redirect_max_age", "query_policy", "schema_name", "details", "cache", "response", "rewrite_to", "header_rules"}).
+				AddRow(new("backend1"), new("/path1"), new("exact"), nil, nil, nil, nil, nil, new("guidance"), new(""), nil, nil, nil, nil).
+				AddRow(new("backend2"), new("/path2"), new("prefix"), nil, nil, nil, nil, nil, new("guidance"), new(""), nil, nil, nil, nil)
 
 			mockPool.ExpectQuery("WITH").WillReturnRows(rows)
 
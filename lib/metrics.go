@@ -36,6 +36,28 @@ var (
 		},
 		[]string{"source"},
 	)
+
+	redirectLoopsMetric = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "router_redirect_loop_routes",
+			Help: "Number of redirect routes ignored in the last route load because they lead to a redirect loop",
+		},
+	)
+
+	redirectChainsFlattenedMetric = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "router_redirect_chains_flattened",
+			Help: "Number of redirect routes pointed straight at the end of a chain of redirects in the last route load",
+		},
+	)
+
+	brokenRedirectsMetric = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "router_broken_redirect_routes",
+			Help: "Number of redirect routes in the last route load whose targets respond with an error, by status code",
+		},
+		[]string{"status"},
+	)
 )
 
 func registerMetrics(r prometheus.Registerer) {
@@ -43,6 +65,9 @@ func registerMetrics(r prometheus.Registerer) {
 		internalServerErrorCountMetric,
 		routeReloadDurationMetric,
 		routesCountMetric,
+		redirectLoopsMetric,
+		redirectChainsFlattenedMetric,
+		brokenRedirectsMetric,
 	)
 	handlers.RegisterMetrics(r)
 	triemux.RegisterMetrics(r)
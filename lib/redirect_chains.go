@@ -0,0 +1,209 @@
+package router
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/rs/zerolog"
+
+	"github.com/alphagov/router/handlers"
+	"github.com/alphagov/router/trie"
+)
+
+// routeIndex finds the route that the mux would choose for a path, so that
+// routes can be checked against each other before they're loaded.
+type routeIndex struct {
+	exact  *trie.Trie[*indexedRoute]
+	prefix *trie.Trie[*indexedRoute]
+}
+
+type indexedRoute struct {
+	route *Route
+	path  string
+}
+
+func newRouteIndex(routes []*Route) *routeIndex {
+	index := &routeIndex{
+		exact:  trie.NewTrie[*indexedRoute](),
+		prefix: trie.NewTrie[*indexedRoute](),
+	}
+	for _, route := range routes {
+		if route.IncomingPath == nil || route.RouteType == nil {
+			continue
+		}
+		incomingURL, err := url.Parse(*route.IncomingPath)
+		if err != nil {
+			continue
+		}
+		t := index.exact
+		if *route.RouteType == RouteTypePrefix {
+			t = index.prefix
+		}
+		t.Set(splitRoutePath(incomingURL.Path), &indexedRoute{route, incomingURL.Path})
+	}
+	return index
+}
+
+// lookup returns the route for path, preferring an exact route to the route
+// with the longest matching prefix in the same way as the mux.
+func (index *routeIndex) lookup(path string) (*indexedRoute, bool) {
+	segments := splitRoutePath(path)
+	if entry, ok := index.exact.Get(segments); ok {
+		return entry, true
+	}
+	return index.prefix.GetLongestPrefix(segments)
+}
+
+// splitRoutePath splits a URL path into segments, ignoring empty segments in
+// the same way as the mux.
+func splitRoutePath(path string) []string {
+	return strings.FieldsFunc(path, func(r rune) bool { return r == '/' })
+}
+
+// redirectChain is where a request to the incoming path of a redirect route
+// ends up after following any internal redirects from its target.
+type redirectChain struct {
+	// target and queryPolicy are for a single redirect straight to the end of
+	// the part of the chain that can be flattened.
+	target      string
+	queryPolicy string
+	// flattened is the number of redirects that were skipped to get to target.
+	flattened int
+	// loop is set if the chain leads back to a redirect already in it.
+	loop bool
+}
+
+// resolveRedirect follows the chain of internal redirects from the target of
+// route. Redirects that preserve the path go to a different target for each
+// request under their prefix, so chains starting from them are only followed
+// to check for loops. Chains are flattened only through permanent redirects
+// whose targets have no query string or fragment, so that the result is the
+// same as following them one at a time.
+func (index *routeIndex) resolveRedirect(route *Route) redirectChain {
+	preserve := shouldPreserveSegments(*route.RouteType, route.segmentsMode())
+	chain := redirectChain{
+		target:      *route.RedirectTo,
+		queryPolicy: route.queryPolicy(),
+	}
+	if chain.queryPolicy == "" {
+		chain.queryPolicy = handlers.DefaultQueryPolicy(preserve)
+	}
+	flatten := !preserve && !strings.ContainsAny(chain.target, "?#")
+
+	location := chain.target
+	visited := map[*Route]bool{route: true}
+	for isInternalLocation(location) {
+		path := trimQueryAndFragment(location)
+		next, ok := index.lookup(path)
+		if !ok || !loadableRedirect(next.route) {
+			break
+		}
+		if visited[next.route] {
+			chain.loop = true
+			break
+		}
+		visited[next.route] = true
+
+		location = *next.route.RedirectTo
+		nextPreserve := shouldPreserveSegments(*next.route.RouteType, next.route.segmentsMode())
+		if nextPreserve {
+			location = insertPathSuffix(location, strings.TrimPrefix(path, next.path))
+		}
+
+		code := next.route.redirectCode()
+		permanent := code == http.StatusMovedPermanently || code == http.StatusPermanentRedirect
+		flatten = flatten && permanent && !strings.ContainsAny(*next.route.RedirectTo, "?#")
+		if flatten {
+			nextPolicy := next.route.queryPolicy()
+			if nextPolicy == "" {
+				nextPolicy = handlers.DefaultQueryPolicy(nextPreserve)
+			}
+			chain.target = location
+			chain.queryPolicy = combineQueryPolicies(chain.queryPolicy, nextPolicy)
+			chain.flattened++
+		}
+	}
+	return chain
+}
+
+// loadableRedirect reports whether route is a redirect route that addHandler
+// would load.
+func loadableRedirect(route *Route) bool {
+	return route.redirect() &&
+		route.RedirectTo != nil &&
+		handlers.IsRedirectCode(route.redirectCode()) &&
+		handlers.IsQueryPolicy(route.queryPolicy())
+}
+
+// isInternalLocation reports whether a redirect location is a path on this
+// site rather than an absolute or protocol-relative URL.
+func isInternalLocation(location string) bool {
+	return strings.HasPrefix(location, "/") && !strings.HasPrefix(location, "//")
+}
+
+func trimQueryAndFragment(location string) string {
+	if i := strings.IndexAny(location, "?#"); i >= 0 {
+		return location[:i]
+	}
+	return location
+}
+
+// insertPathSuffix appends suffix to the path of location, before any query
+// string or fragment.
+func insertPathSuffix(location, suffix string) string {
+	if i := strings.IndexAny(location, "?#"); i >= 0 {
+		return location[:i] + suffix + location[i:]
+	}
+	return location + suffix
+}
+
+// combineQueryPolicies returns the query policy of a single redirect with the
+// same effect on the query string as a redirect with policy first followed by
+// a redirect with policy second, where neither target has a query string.
+func combineQueryPolicies(first, second string) string {
+	switch {
+	case first == handlers.QueryPolicyDrop || second == handlers.QueryPolicyDrop:
+		return handlers.QueryPolicyDrop
+	case second == handlers.QueryPolicyAllowlist:
+		return handlers.QueryPolicyAllowlist
+	default:
+		return first
+	}
+}
+
+// flattenRedirects points redirect routes whose target is itself redirected
+// straight at the final destination, so that users don't bounce through
+// several redirects, and drops redirect routes which lead to a redirect loop.
+func flattenRedirects(routes []*Route, logger zerolog.Logger) []*Route {
+	index := newRouteIndex(routes)
+
+	result := make([]*Route, 0, len(routes))
+	flattened, loops := 0, 0
+	for _, route := range routes {
+		if route.IncomingPath == nil || route.RouteType == nil || !loadableRedirect(route) {
+			result = append(result, route)
+			continue
+		}
+
+		chain := index.resolveRedirect(route)
+		switch {
+		case chain.loop:
+			logger.Warn().Str("incoming_path", *route.IncomingPath).Str("redirect_to", *route.RedirectTo).Msg("ignoring redirect route which leads to a redirect loop")
+			loops++
+			continue
+		case chain.flattened > 0:
+			logger.Debug().Str("incoming_path", *route.IncomingPath).Str("redirect_to", *route.RedirectTo).Str("flattened_to", chain.target).Int("flattened", chain.flattened).Msg("flattened redirect chain")
+			flat := *route
+			flat.RedirectTo = &chain.target
+			flat.QueryPolicy = &chain.queryPolicy
+			route = &flat
+			flattened++
+		}
+		result = append(result, route)
+	}
+
+	redirectLoopsMetric.Set(float64(loops))
+	redirectChainsFlattenedMetric.Set(float64(flattened))
+	return result
+}
@@ -0,0 +1,145 @@
+package router
+
+import (
+	"net/http"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	promtest "github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/rs/zerolog"
+
+	"github.com/alphagov/router/handlers"
+)
+
+func redirectRoute(path, routeType, target string) *Route {
+	return &Route{
+		IncomingPath: new(path),
+		RouteType:    new(routeType),
+		RedirectTo:   new(target),
+		SchemaName:   new(HandlerTypeRedirect),
+	}
+}
+
+var _ = Describe("flattenRedirects", func() {
+	var logger zerolog.Logger
+
+	BeforeEach(func() {
+		logger = zerolog.Nop()
+	})
+
+	targets := func(routes []*Route) map[string]string {
+		result := map[string]string{}
+		for _, route := range routes {
+			if route.RedirectTo != nil {
+				result[*route.IncomingPath] = *route.RedirectTo
+			}
+		}
+		return result
+	}
+
+	It("points redirects at the end of a chain of redirects", func() {
+		routes := flattenRedirects([]*Route{
+			redirectRoute("/a", RouteTypeExact, "/b"),
+			redirectRoute("/b", RouteTypeExact, "/c"),
+			redirectRoute("/c", RouteTypeExact, "/d"),
+			{IncomingPath: new("/d"), RouteType: new(RouteTypeExact), BackendID: new("backend1")},
+		}, logger)
+
+		Expect(routes).To(HaveLen(4))
+		Expect(targets(routes)).To(Equal(map[string]string{"/a": "/d", "/b": "/d", "/c": "/d"}))
+		Expect(promtest.ToFloat64(redirectChainsFlattenedMetric)).To(Equal(2.0))
+	})
+
+	It("follows redirects that preserve the path", func() {
+		routes := flattenRedirects([]*Route{
+			redirectRoute("/a", RouteTypeExact, "/b/c"),
+			redirectRoute("/b", RouteTypePrefix, "/new-b"),
+		}, logger)
+
+		Expect(targets(routes)).To(HaveKeyWithValue("/a", "/new-b/c"))
+	})
+
+	It("follows redirects to external URLs", func() {
+		routes := flattenRedirects([]*Route{
+			redirectRoute("/a", RouteTypeExact, "/b"),
+			redirectRoute("/b", RouteTypeExact, "https://example.com/b"),
+		}, logger)
+
+		Expect(targets(routes)).To(HaveKeyWithValue("/a", "https://example.com/b"))
+	})
+
+	It("combines the query policies of the redirects in the chain", func() {
+		first := redirectRoute("/a", RouteTypeExact, "/b")
+		first.QueryPolicy = new(handlers.QueryPolicyPreserve)
+		routes := flattenRedirects([]*Route{
+			first,
+			redirectRoute("/b", RouteTypeExact, "/c"),
+		}, logger)
+
+		Expect(*routes[0].RedirectTo).To(Equal("/c"))
+		Expect(*routes[0].QueryPolicy).To(Equal(handlers.QueryPolicyAllowlist))
+		Expect(*first.RedirectTo).To(Equal("/b"), "the original route should not be modified")
+	})
+
+	It("doesn't flatten temporary redirects", func() {
+		temporary := redirectRoute("/b", RouteTypeExact, "/c")
+		temporary.RedirectCode = new(http.StatusFound)
+		routes := flattenRedirects([]*Route{
+			redirectRoute("/a", RouteTypeExact, "/b"),
+			temporary,
+		}, logger)
+
+		Expect(targets(routes)).To(HaveKeyWithValue("/a", "/b"))
+	})
+
+	It("doesn't flatten redirects to targets with a query string", func() {
+		routes := flattenRedirects([]*Route{
+			redirectRoute("/a", RouteTypeExact, "/b"),
+			redirectRoute("/b", RouteTypeExact, "/c?d=e"),
+		}, logger)
+
+		Expect(targets(routes)).To(HaveKeyWithValue("/a", "/b"))
+	})
+
+	It("doesn't flatten chains from redirects that preserve the path", func() {
+		routes := flattenRedirects([]*Route{
+			redirectRoute("/a", RouteTypePrefix, "/b"),
+			redirectRoute("/b", RouteTypeExact, "/c"),
+		}, logger)
+
+		Expect(targets(routes)).To(HaveKeyWithValue("/a", "/b"))
+	})
+
+	It("stops at targets which are served by a more specific route", func() {
+		routes := flattenRedirects([]*Route{
+			redirectRoute("/a", RouteTypeExact, "/b/c"),
+			redirectRoute("/b", RouteTypePrefix, "/new-b"),
+			{IncomingPath: new("/b/c"), RouteType: new(RouteTypeExact), BackendID: new("backend1")},
+		}, logger)
+
+		Expect(targets(routes)).To(HaveKeyWithValue("/a", "/b/c"))
+	})
+
+	It("drops redirects which lead to a redirect loop", func() {
+		routes := flattenRedirects([]*Route{
+			redirectRoute("/a", RouteTypeExact, "/b"),
+			redirectRoute("/b", RouteTypeExact, "/a"),
+			redirectRoute("/c", RouteTypeExact, "/a"),
+			redirectRoute("/d", RouteTypeExact, "/d"),
+			redirectRoute("/e", RouteTypeExact, "/f"),
+		}, logger)
+
+		Expect(targets(routes)).To(Equal(map[string]string{"/e": "/f"}))
+		Expect(promtest.ToFloat64(redirectLoopsMetric)).To(Equal(4.0))
+	})
+
+	It("drops redirects which lead to a loop through redirects that preserve the path", func() {
+		routes := flattenRedirects([]*Route{
+			redirectRoute("/a", RouteTypePrefix, "/b"),
+			redirectRoute("/b", RouteTypePrefix, "/c/b"),
+			redirectRoute("/c", RouteTypePrefix, "/a"),
+		}, logger)
+
+		Expect(routes).To(BeEmpty())
+	})
+})
@@ -0,0 +1,76 @@
+package router
+
+import (
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+
+	"github.com/rs/zerolog"
+
+	"github.com/alphagov/router/handlers"
+	"github.com/alphagov/router/triemux"
+)
+
+// BrokenRedirect is a redirect route whose target is a path on this site
+// that Router would respond to with an error.
+type BrokenRedirect struct {
+	IncomingPath string `json:"incoming_path"`
+	RedirectTo   string `json:"redirect_to"`
+	Status       int    `json:"status"`
+}
+
+// brokenRedirects holds the broken redirects found in the last route load, so
+// that they can be listed on the API server.
+var brokenRedirects struct {
+	mu        sync.RWMutex
+	redirects []BrokenRedirect
+}
+
+// BrokenRedirects returns the redirect routes found in the last route load
+// whose targets would respond with 400 Bad Request, 404 Not Found or 410 Gone.
+func BrokenRedirects() []BrokenRedirect {
+	brokenRedirects.mu.RLock()
+	defer brokenRedirects.mu.RUnlock()
+	return brokenRedirects.redirects
+}
+
+// checkRedirectTargets looks up the target of every internal redirect in the
+// loaded routes with the mux they were loaded into, and records the redirects
+// whose target is rejected, isn't routed or is a gone route.
+func checkRedirectTargets(mux *triemux.Mux, routes []*Route, logger zerolog.Logger) {
+	broken := []BrokenRedirect{}
+	counts := map[int]int{http.StatusBadRequest: 0, http.StatusNotFound: 0, http.StatusGone: 0}
+	for _, route := range routes {
+		if !route.redirect() || route.RedirectTo == nil || !isInternalLocation(*route.RedirectTo) {
+			continue
+		}
+		targetURL, err := url.Parse(*route.RedirectTo)
+		if err != nil {
+			continue
+		}
+
+		handler, status := mux.Resolve(targetURL.EscapedPath())
+		if handler != nil {
+			if info, ok := handlers.HandlerRouteInfo(handler); !ok || info.HandlerType != HandlerTypeGone {
+				continue
+			}
+			status = http.StatusGone
+		}
+
+		logger.Debug().Str("incoming_path", *route.IncomingPath).Str("redirect_to", *route.RedirectTo).Int("status", status).Msg("redirect route has a broken target")
+		broken = append(broken, BrokenRedirect{*route.IncomingPath, *route.RedirectTo, status})
+		counts[status]++
+	}
+
+	for status, count := range counts {
+		brokenRedirectsMetric.WithLabelValues(strconv.Itoa(status)).Set(float64(count))
+	}
+	if len(broken) > 0 {
+		logger.Info().Int("broken_redirects", len(broken)).Msg("found redirect routes whose targets respond with 400, 404 or 410")
+	}
+
+	brokenRedirects.mu.Lock()
+	brokenRedirects.redirects = broken
+	brokenRedirects.mu.Unlock()
+}
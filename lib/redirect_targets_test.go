@@ -0,0 +1,70 @@
+package router
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	promtest "github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/rs/zerolog"
+
+	"github.com/alphagov/router/handlers"
+	"github.com/alphagov/router/triemux"
+)
+
+var _ = Describe("checkRedirectTargets", func() {
+	BeforeEach(func() {
+		handlers.Canonical = &handlers.CanonicalRules{
+			PathNormalisation: handlers.PathNormalisation{DotSegments: handlers.PathPolicyReject},
+		}
+		DeferCleanup(func() { handlers.Canonical = nil })
+
+		mux := triemux.NewMux(zerolog.Nop())
+		backends := map[string]http.Handler{"backend1": http.NotFoundHandler(), "frontend": http.NotFoundHandler()}
+		Expect(addRoutes(mux, []*Route{
+			redirectRoute("/to-backend", RouteTypeExact, "/backend/page"),
+			redirectRoute("/to-missing", RouteTypeExact, "/missing?q=1"),
+			redirectRoute("/to-gone", RouteTypePrefix, "/gone"),
+			redirectRoute("/to-uppercase-gone", RouteTypeExact, "/GONE"),
+			redirectRoute("/to-gone-with-details", RouteTypeExact, "/gone-with-details"),
+			redirectRoute("/to-unloaded", RouteTypeExact, "/unloaded"),
+			redirectRoute("/to-rejected", RouteTypeExact, "/backend/../page"),
+			redirectRoute("/to-external", RouteTypeExact, "https://example.com/missing"),
+			{IncomingPath: new("/backend"), RouteType: new(RouteTypePrefix), BackendID: new("backend1")},
+			{IncomingPath: new("/gone"), RouteType: new(RouteTypeExact), SchemaName: new(HandlerTypeGone)},
+			{IncomingPath: new("/gone-with-details"), RouteType: new(RouteTypeExact), SchemaName: new(HandlerTypeGone), Details: new(`{"explanation": "Moved"}`)},
+			{IncomingPath: new("/unloaded"), RouteType: new(RouteTypeExact), BackendID: new("unknown")},
+		}, backends, zerolog.Nop())).To(Succeed())
+	})
+
+	It("records redirects whose targets the mux would respond to with 400, 404 or 410", func() {
+		Expect(BrokenRedirects()).To(ConsistOf(
+			BrokenRedirect{IncomingPath: "/to-missing", RedirectTo: "/missing?q=1", Status: http.StatusNotFound},
+			BrokenRedirect{IncomingPath: "/to-gone", RedirectTo: "/gone", Status: http.StatusGone},
+			BrokenRedirect{IncomingPath: "/to-uppercase-gone", RedirectTo: "/GONE", Status: http.StatusGone},
+			BrokenRedirect{IncomingPath: "/to-unloaded", RedirectTo: "/unloaded", Status: http.StatusNotFound},
+			BrokenRedirect{IncomingPath: "/to-rejected", RedirectTo: "/backend/../page", Status: http.StatusBadRequest},
+		))
+	})
+
+	It("sets the broken redirects metric by status", func() {
+		Expect(promtest.ToFloat64(brokenRedirectsMetric.WithLabelValues("400"))).To(Equal(1.0))
+		Expect(promtest.ToFloat64(brokenRedirectsMetric.WithLabelValues("404"))).To(Equal(2.0))
+		Expect(promtest.ToFloat64(brokenRedirectsMetric.WithLabelValues("410"))).To(Equal(2.0))
+	})
+
+	It("lists the broken redirects on the API server", func() {
+		api, err := NewAPIHandler(&Router{Logger: zerolog.Nop()})
+		Expect(err).NotTo(HaveOccurred())
+
+		rr := httptest.NewRecorder()
+		api.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/redirects/broken", nil))
+		Expect(rr.Code).To(Equal(http.StatusOK))
+
+		var listed []BrokenRedirect
+		Expect(json.Unmarshal(rr.Body.Bytes(), &listed)).To(Succeed())
+		Expect(listed).To(Equal(BrokenRedirects()))
+	})
+})
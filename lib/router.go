@@ -12,6 +12,7 @@ import (
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/rs/zerolog"
 
+	"github.com/alphagov/router/handlers"
 	"github.com/alphagov/router/triemux"
 )
 
@@ -138,11 +139,19 @@ func NewRouter(o Options) (rt *Router, err error) {
 }
 
 // ServeHTTP delegates responsibility for serving requests to the proxy mux
-// instance for this router.
+// instance for this router, finding the client's IP address and adding a
+// request ID and any security headers, and writes the request to the access
+// log. Requests over their rate limit are rejected before looking up a route.
 func (rt *Router) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	req = handlers.WithClientIP(req)
+	req = handlers.WithRequestID(w, req)
+	w, req, logAccess := handlers.LogAccess(w, req)
+	defer logAccess()
+	w = handlers.AddSecurityHeaders(w)
+
 	defer func() {
 		if r := recover(); r != nil {
-			rt.Logger.Err(fmt.Errorf("%v", r)).Msgf("recovered from panic in ServeHTTP")
+			rt.Logger.Err(fmt.Errorf("%v", r)).Str("request_id", handlers.RequestID(req.Context())).Msgf("recovered from panic in ServeHTTP")
 
 			w.WriteHeader(http.StatusInternalServerError)
 
@@ -150,6 +159,10 @@ func (rt *Router) ServeHTTP(w http.ResponseWriter, req *http.Request) {
 		}
 	}()
 
+	if handlers.ServeRateLimited(w, req) {
+		return
+	}
+
 	var mux *triemux.Mux
 
 	rt.lock.RLock()
@@ -2,10 +2,14 @@ package router
 
 import (
 	"encoding/json"
+	"fmt"
 	"net/http"
 	"runtime"
+	"strings"
 
 	"github.com/prometheus/client_golang/prometheus/promhttp"
+
+	"github.com/alphagov/router/handlers"
 )
 
 func NewAPIHandler(rout *Router) (api http.Handler, err error) {
@@ -65,6 +69,60 @@ func NewAPIHandler(rout *Router) (api http.Handler, err error) {
 		}
 	})
 
+	mux.HandleFunc("/redirects/broken", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			w.Header().Set("Allow", http.MethodGet)
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+
+		jsonData, err := json.MarshalIndent(BrokenRedirects(), "", "  ")
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			rout.Logger.Error().Err(err).Msg("failed to marshal broken redirects")
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		_, err = w.Write(jsonData)
+		if err != nil {
+			rout.Logger.Warn().Err(err).Msg("failed to write response")
+		}
+	})
+
+	if handlers.ResponseCache != nil || handlers.StaleResponses != nil {
+		mux.HandleFunc("/cache/purge", func(w http.ResponseWriter, r *http.Request) {
+			if r.Method != http.MethodPost {
+				w.Header().Set("Allow", http.MethodPost)
+				w.WriteHeader(http.StatusMethodNotAllowed)
+				return
+			}
+
+			path := r.URL.Query().Get("path")
+			if !strings.HasPrefix(path, "/") {
+				http.Error(w, "path must be an absolute URL path", http.StatusBadRequest)
+				return
+			}
+			prefix := r.URL.Query().Get("prefix") == "true"
+
+			// Stale responses are purged too, or the old page would be
+			// served again the next time the backend fails.
+			purged := 0
+			if handlers.ResponseCache != nil {
+				purged += handlers.ResponseCache.PurgePath(path, prefix)
+			}
+			if handlers.StaleResponses != nil {
+				purged += handlers.StaleResponses.PurgePath(path, prefix)
+			}
+			rout.Logger.Info().Str("path", path).Bool("prefix", prefix).Int("purged", purged).Msg("purged cached responses")
+
+			_, err := fmt.Fprintf(w, "Purged %d responses", purged)
+			if err != nil {
+				rout.Logger.Warn().Err(err).Msg("failed to write response")
+			}
+		})
+	}
+
 	mux.Handle("/metrics", promhttp.Handler())
 
 	return mux, nil
@@ -2,12 +2,18 @@ package router
 
 import (
 	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/alphagov/router/handlers"
 )
 
 const (
 	HandlerTypeBackend  = "backend"
 	HandlerTypeRedirect = "redirect"
 	HandlerTypeGone     = "gone"
+	HandlerTypeStatic   = "static"
+	HandlerTypeRewrite  = "rewrite"
 )
 
 /*
@@ -16,17 +22,31 @@ RouteType is the type of matching the route should do (exact/prefix)
 BackendID is the backend application (e.g. frontend, publisher etc...)
 RedirectTo is the redirect location for a redirect route
 SegmentsMode indicates whether the URL path for a redirect route should be preserved (preserve/ignore)
+RedirectCode is the HTTP status code for a redirect route (301, 302, 303, 307 or 308)
+RedirectMaxAge is how many seconds a redirect route may be cached for (0 means it must not be cached)
+QueryPolicy is what a redirect route does with the query string (drop/preserve/allowlist/merge)
 SchemaName indicates the type of route (backend, redirect, gone)
 Details contains additional information about the route
+Cache indicates whether Router may cache responses for a backend route (defaults to true)
+Response is the response Router serves itself for a static route, as JSON
+RewriteTo is the path on the backend that requests for a rewrite route are sent to
+HeaderRules are the request and response header operations for a backend or rewrite route, as JSON
 */
 type Route struct {
-	IncomingPath *string
-	RouteType    *string
-	BackendID    *string
-	RedirectTo   *string
-	SegmentsMode *string
-	SchemaName   *string
-	Details      *string
+	IncomingPath   *string
+	RouteType      *string
+	BackendID      *string
+	RedirectTo     *string
+	SegmentsMode   *string
+	RedirectCode   *int
+	RedirectMaxAge *int
+	QueryPolicy    *string
+	SchemaName     *string
+	Details        *string
+	Cache          *bool
+	Response       *string
+	RewriteTo      *string
+	HeaderRules    *string
 }
 
 // Determine the handler type associated with a route
@@ -36,6 +56,10 @@ func (route *Route) handlerType() string {
 		return HandlerTypeRedirect
 	case route.gone():
 		return HandlerTypeGone
+	case route.static():
+		return HandlerTypeStatic
+	case route.rewrite():
+		return HandlerTypeRewrite
 	default:
 		return HandlerTypeBackend
 	}
@@ -62,11 +86,16 @@ func (route *Route) backend() *string {
 Determine whether to return a gone handler for a gone route:
 (i) Details field is nil
 (ii) Details field isn't valid jSON
+(iii) Router renders gone pages with details itself
 
 If the details field is empty (e.g. {}) then use a backend handler.
 */
 func (route *Route) gone() bool {
 	if route.SchemaName != nil && *route.SchemaName == "gone" {
+		if handlers.RenderGonePages {
+			return true
+		}
+
 		// If the details field is nil, use a standard gone route
 		if route.Details == nil {
 			return true
@@ -91,10 +120,84 @@ func (route *Route) gone() bool {
 	return false
 }
 
+// Returns the details to render the page for a gone route with, or nil if it doesn't have any
+func (route *Route) goneDetails() *handlers.GoneDetails {
+	if route.Details == nil {
+		return nil
+	}
+	details := &handlers.GoneDetails{}
+	if err := json.Unmarshal([]byte(*route.Details), details); err != nil {
+		return nil
+	}
+	if *details == (handlers.GoneDetails{}) {
+		return nil
+	}
+	return details
+}
+
+// Determine whether Router serves a fixed response for a route rather than a backend. A JSON null
+// response, from "response": null in content-store, means the route doesn't have one.
+func (route *Route) static() bool {
+	return route.Response != nil && *route.Response != "null"
+}
+
+// Returns the response to serve for a static route
+func (route *Route) staticResponse() (handlers.StaticResponse, error) {
+	var response handlers.StaticResponse
+	err := json.Unmarshal([]byte(*route.Response), &response)
+	return response, err
+}
+
+// Returns the header rules for a backend or rewrite route, or nil if it doesn't have any
+func (route *Route) headerRules() (*handlers.HeaderRules, error) {
+	if route.HeaderRules == nil {
+		return nil, nil
+	}
+	rules := &handlers.HeaderRules{}
+	if err := json.Unmarshal([]byte(*route.HeaderRules), rules); err != nil {
+		return nil, err
+	}
+	return rules, nil
+}
+
+// Determine whether requests for a route are sent to its backend with a different path
+func (route *Route) rewrite() bool {
+	return route.RewriteTo != nil
+}
+
 func (route *Route) redirect() bool {
 	return route.SchemaName != nil && *route.SchemaName == "redirect"
 }
 
+// Returns the HTTP status code to use for a redirect route, defaulting to 301
+func (route *Route) redirectCode() int {
+	if route.RedirectCode == nil {
+		return http.StatusMovedPermanently
+	}
+	return *route.RedirectCode
+}
+
+// Returns how long a redirect route may be cached for, or the default if the route doesn't set it
+func (route *Route) redirectCacheDuration(defaultDuration time.Duration) time.Duration {
+	if route.RedirectMaxAge == nil || *route.RedirectMaxAge < 0 {
+		return defaultDuration
+	}
+	return time.Duration(*route.RedirectMaxAge) * time.Second
+}
+
+// Returns the query policy for a redirect route, or the empty string to use the handler's default
+func (route *Route) queryPolicy() string {
+	if route.QueryPolicy == nil {
+		return ""
+	}
+	return *route.QueryPolicy
+}
+
+// Determine whether responses for a backend route may be cached by Router
+func (route *Route) cacheEnabled() bool {
+	return route.Cache == nil || *route.Cache
+}
+
 /*
 Returns a flag (e.g. preserve, ignore) that is used to determine whether the URL path in a redirect route should be preserved.
 Explicit logic to handle the case where a redirect route doesn't have a segmentsMode explicitly defined.
@@ -1,8 +1,13 @@
 package router
 
 import (
+	"net/http"
+	"time"
+
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
+
+	"github.com/alphagov/router/handlers"
 )
 
 var _ = Describe("Route", func() {
@@ -53,7 +58,29 @@ var _ = Describe("Route", func() {
 			})
 		})
 
-		Context("when route is neither redirect nor gone", func() {
+		Context("when route has a response", func() {
+			It("should return 'static'", func() {
+				route.SchemaName = new("special_route")
+				route.Response = new(`{"body": "User-agent: *"}`)
+				Expect(route.handlerType()).To(Equal(HandlerTypeStatic))
+			})
+		})
+
+		Context("when route has a null response", func() {
+			It("should return 'backend'", func() {
+				route.Response = new("null")
+				Expect(route.handlerType()).To(Equal(HandlerTypeBackend))
+			})
+		})
+
+		Context("when route has a rewrite path", func() {
+			It("should return 'rewrite'", func() {
+				route.RewriteTo = new("/topics")
+				Expect(route.handlerType()).To(Equal(HandlerTypeRewrite))
+			})
+		})
+
+		Context("when route is neither redirect, gone, static nor rewrite", func() {
 			It("should return 'backend'", func() {
 				Expect(route.handlerType()).To(Equal(HandlerTypeBackend))
 			})
@@ -86,6 +113,17 @@ var _ = Describe("Route", func() {
 			})
 		})
 
+		Context("when schema is 'gone', details is not empty and Router renders gone pages", func() {
+			It("should return true", func() {
+				handlers.RenderGonePages = true
+				defer func() { handlers.RenderGonePages = false }()
+
+				route.SchemaName = new("gone")
+				route.Details = new(`{"explanation": "gone"}`)
+				Expect(route.gone()).To(BeTrue())
+			})
+		})
+
 		Context("when schema is 'gone' and details is invalid json", func() {
 			It("should return true", func() {
 				route.SchemaName = new("gone")
@@ -149,4 +187,68 @@ var _ = Describe("Route", func() {
 			})
 		})
 	})
+
+	Describe("goneDetails", func() {
+		It("should return nil if details is nil, empty or invalid", func() {
+			Expect(route.goneDetails()).To(BeNil())
+
+			for _, details := range []string{"", "{}", `{"explanation": null}`, "{invalid}"} {
+				route.Details = new(details)
+				Expect(route.goneDetails()).To(BeNil(), details)
+			}
+		})
+
+		It("should return the details of the gone route", func() {
+			route.Details = new(`{"explanation": "<p>gone</p>", "alternative_path": "/new", "withdrawn_at": "2024-03-05T10:00:00Z", "other": 1}`)
+			Expect(route.goneDetails()).To(Equal(&handlers.GoneDetails{
+				AlternativePath: "/new",
+				Explanation:     "<p>gone</p>",
+				WithdrawnAt:     "2024-03-05T10:00:00Z",
+			}))
+		})
+	})
+
+	Describe("cacheEnabled", func() {
+		It("should return true if cache is not set", func() {
+			Expect(route.cacheEnabled()).To(BeTrue())
+		})
+
+		It("should return the value of cache if set", func() {
+			route.Cache = new(false)
+			Expect(route.cacheEnabled()).To(BeFalse())
+
+			route.Cache = new(true)
+			Expect(route.cacheEnabled()).To(BeTrue())
+		})
+	})
+
+	Describe("redirectCode", func() {
+		It("should return 301 if redirect code is not set", func() {
+			Expect(route.redirectCode()).To(Equal(http.StatusMovedPermanently))
+		})
+
+		It("should return the redirect code if set", func() {
+			route.RedirectCode = new(http.StatusFound)
+			Expect(route.redirectCode()).To(Equal(http.StatusFound))
+		})
+	})
+
+	Describe("redirectCacheDuration", func() {
+		It("should return the default if redirect max age is not set", func() {
+			Expect(route.redirectCacheDuration(time.Hour)).To(Equal(time.Hour))
+		})
+
+		It("should return the default if redirect max age is negative", func() {
+			route.RedirectMaxAge = new(-1)
+			Expect(route.redirectCacheDuration(time.Hour)).To(Equal(time.Hour))
+		})
+
+		It("should return the redirect max age if set", func() {
+			route.RedirectMaxAge = new(0)
+			Expect(route.redirectCacheDuration(time.Hour)).To(BeZero())
+
+			route.RedirectMaxAge = new(86400)
+			Expect(route.redirectCacheDuration(time.Hour)).To(Equal(24 * time.Hour))
+		})
+	})
 })
@@ -9,11 +9,18 @@ SELECT
     route ->> 'type' AS match_type,
     route ->> 'destination' AS destination,
     route ->> 'segments_mode' AS segments_mode,
+    route ->> 'redirect_code' AS redirect_code,
+    route ->> 'redirect_max_age' AS redirect_max_age,
+    route ->> 'query_policy' AS query_policy,
     content_items.schema_name AS schema_name,
     CASE
         WHEN content_items.schema_name = 'gone' THEN content_items.details
         ELSE NULL
-    END AS details
+    END AS details,
+    route ->> 'cache' AS cache,
+    route -> 'response' AS response,
+    route ->> 'rewrite_to' AS rewrite_to,
+    route -> 'header_rules' AS header_rules
 FROM content_items, LATERAL jsonb_array_elements(
         content_items.routes || content_items.redirects
     ) AS route
@@ -24,8 +31,15 @@ SELECT
     route ->> 'type' AS match_type,
     route ->> 'destination' AS destination,
     route ->> 'segments_mode' AS segments_mode,
+    route ->> 'redirect_code' AS redirect_code,
+    route ->> 'redirect_max_age' AS redirect_max_age,
+    route ->> 'query_policy' AS query_policy,
     NULL AS schema_name,
-    NULL AS details
+    NULL AS details,
+    route ->> 'cache' AS cache,
+    route -> 'response' AS response,
+    route ->> 'rewrite_to' AS rewrite_to,
+    route -> 'header_rules' AS header_rules
 FROM publish_intents, LATERAL jsonb_array_elements(publish_intents.routes) AS route
 WHERE
     NOT EXISTS (
@@ -0,0 +1,169 @@
+package router
+
+import (
+	"context"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/rs/zerolog"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace/noop"
+	collectortrace "go.opentelemetry.io/proto/otlp/collector/trace/v1"
+	tracepb "go.opentelemetry.io/proto/otlp/trace/v1"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/alphagov/router/handlers"
+	"github.com/alphagov/router/triemux"
+)
+
+// fakeCollector is an OTLP/HTTP collector which keeps the spans sent to it.
+type fakeCollector struct {
+	mu    sync.Mutex
+	paths []string
+	spans []*tracepb.Span
+}
+
+func (c *fakeCollector) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(r.Body)
+	Expect(err).NotTo(HaveOccurred())
+
+	req := &collectortrace.ExportTraceServiceRequest{}
+	Expect(proto.Unmarshal(body, req)).To(Succeed())
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.paths = append(c.paths, r.URL.Path)
+	for _, resourceSpans := range req.GetResourceSpans() {
+		for _, scopeSpans := range resourceSpans.GetScopeSpans() {
+			c.spans = append(c.spans, scopeSpans.GetSpans()...)
+		}
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+func (c *fakeCollector) span(name string, kind tracepb.Span_SpanKind) *tracepb.Span {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, span := range c.spans {
+		if span.GetName() == name && span.GetKind() == kind {
+			return span
+		}
+	}
+	return nil
+}
+
+func stringAttribute(span *tracepb.Span, key string) string {
+	for _, attr := range span.GetAttributes() {
+		if attr.GetKey() == key {
+			return attr.GetValue().GetStringValue()
+		}
+	}
+	return ""
+}
+
+func boolAttribute(span *tracepb.Span, key string) bool {
+	for _, attr := range span.GetAttributes() {
+		if attr.GetKey() == key {
+			return attr.GetValue().GetBoolValue()
+		}
+	}
+	return false
+}
+
+var _ = Describe("EnableTracing", func() {
+	DescribeTable("rejects invalid configuration",
+		func(endpoint string, sampleRatio float64) {
+			_, err := EnableTracing(context.Background(), endpoint, sampleRatio)
+			Expect(err).To(HaveOccurred())
+			Expect(handlers.TracingEnabled).To(BeFalse())
+		},
+		Entry("endpoint without a scheme", "collector:4318", 1.0),
+		Entry("sample ratio above 1", "http://collector:4318", 1.5),
+		Entry("negative sample ratio", "http://collector:4318", -0.1),
+	)
+})
+
+var _ = Describe("Tracing", func() {
+	const (
+		traceID      = "4bf92f3577b34da6a3ce929d0e0e4736"
+		parentSpanID = "00f067aa0ba902b7"
+	)
+
+	var (
+		collector          *fakeCollector
+		backendTraceparent string
+		shutdown           func(context.Context) error
+		handler            http.Handler
+	)
+
+	BeforeEach(func() {
+		collector = &fakeCollector{}
+		collectorServer := httptest.NewServer(collector)
+		DeferCleanup(collectorServer.Close)
+
+		var err error
+		shutdown, err = EnableTracing(context.Background(), collectorServer.URL, 1)
+		Expect(err).NotTo(HaveOccurred())
+		DeferCleanup(func() {
+			handlers.TracingEnabled = false
+			otel.SetTracerProvider(noop.NewTracerProvider())
+			otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator())
+		})
+
+		backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			backendTraceparent = r.Header.Get("Traceparent")
+			w.WriteHeader(http.StatusOK)
+		}))
+		DeferCleanup(backend.Close)
+		backendURL, err := url.Parse(backend.URL)
+		Expect(err).NotTo(HaveOccurred())
+
+		mux := triemux.NewMux(zerolog.Nop())
+		backends := map[string]http.Handler{
+			"frontend": handlers.NewBackendHandler("frontend", backendURL, time.Second, time.Second, zerolog.Nop()),
+		}
+		Expect(addRoutes(mux, []*Route{{
+			IncomingPath: new("/government"),
+			RouteType:    new(RouteTypePrefix),
+			BackendID:    new("frontend"),
+		}}, backends, zerolog.Nop())).To(Succeed())
+
+		handler = handlers.TraceRequests(&Router{mux: mux, Logger: zerolog.Nop()})
+	})
+
+	It("exports spans for requests to backends, continuing the trace from traceparent", func() {
+		req := httptest.NewRequest(http.MethodGet, "/government/news", nil)
+		req.Header.Set("Traceparent", "00-"+traceID+"-"+parentSpanID+"-01")
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		Expect(rr.Code).To(Equal(http.StatusOK))
+
+		Expect(shutdown(context.Background())).To(Succeed())
+		Expect(collector.paths).To(ContainElement("/v1/traces"))
+
+		server := collector.span("GET", tracepb.Span_SPAN_KIND_SERVER)
+		Expect(server).NotTo(BeNil())
+		Expect(hex.EncodeToString(server.GetTraceId())).To(Equal(traceID))
+		Expect(hex.EncodeToString(server.GetParentSpanId())).To(Equal(parentSpanID))
+		Expect(stringAttribute(server, "router.handler_type")).To(Equal(HandlerTypeBackend))
+
+		lookup := collector.span("triemux.lookup", tracepb.Span_SPAN_KIND_INTERNAL)
+		Expect(lookup).NotTo(BeNil())
+		Expect(lookup.GetParentSpanId()).To(Equal(server.GetSpanId()))
+		Expect(boolAttribute(lookup, "router.route_found")).To(BeTrue())
+
+		client := collector.span("GET", tracepb.Span_SPAN_KIND_CLIENT)
+		Expect(client).NotTo(BeNil())
+		Expect(client.GetParentSpanId()).To(Equal(server.GetSpanId()))
+		Expect(stringAttribute(client, "router.backend_id")).To(Equal("frontend"))
+		Expect(backendTraceparent).To(Equal("00-" + traceID + "-" + hex.EncodeToString(client.GetSpanId()) + "-01"))
+	})
+})
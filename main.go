@@ -5,12 +5,14 @@ import (
 	"errors"
 	"flag"
 	"fmt"
+	"io"
 	"log"
 	"net/http"
 	"os"
 	"os/signal"
 	"runtime"
 	"strconv"
+	"strings"
 	"syscall"
 	"time"
 
@@ -40,6 +42,27 @@ ROUTER_ERROR_LOG=STDERR                 File to log errors to (in JSON format)
 ROUTER_DEBUG=                           Enable debug output if non-empty
 ROUTER_ROUTES_FILE=                     Load routes from a JSONL file instead of PostgreSQL if non-empty
 ROUTER_ENABLE_CONTENT_STORE_UPDATES=    Enable/disable listening for content store updates (default: true)
+ROUTER_ERROR_HEADER=                    Add an X-Router-Error header to backend errors generated by Router if non-empty
+ROUTER_ERROR_PAGES_DIR=                 Directory of error page templates for responses generated by Router
+ROUTER_COALESCE_REQUESTS=               Collapse identical concurrent GET requests into one backend request if non-empty
+ROUTER_STALE_CACHE_MAX_BYTES=0          Memory to use for serving stale-if-error responses when backends fail (0 to disable)
+ROUTER_CACHE_MAX_BYTES=0                Memory to use for caching backend responses (0 to disable)
+ROUTER_REDIRECT_QUERY_ALLOWLIST=_ga     Comma-separated query parameters kept by redirects that don't preserve the whole query string
+ROUTER_CANONICAL_RULES_FILE=            JSON file of host, scheme and path canonicalisation rules applied before route lookup
+ROUTER_RENDER_GONE_PAGES=               Render the pages for gone routes with details in Router rather than frontend if non-empty
+ROUTER_STATIC_FILES_DIR=                Directory of files that static routes can serve
+ROUTER_HEADER_RULES_FILE=               JSON file of request and response header rules for backends
+ROUTER_SECURITY_HEADERS_FILE=           JSON file of security headers to add to responses, with overrides for backends
+ROUTER_TRUST_REQUEST_ID=                Use the GOVUK-Request-Id or X-Request-Id of incoming requests rather than generating one if non-empty
+ROUTER_TRUSTED_PROXIES=                 Comma-separated CIDR ranges of proxies whose X-Forwarded-* headers are trusted (none are trusted if empty)
+ROUTER_RATE_LIMITS_FILE=                JSON file of per-client rate limits for path prefixes
+ROUTER_BACKEND_CONCURRENCY_LIMITS_FILE= JSON file of limits on the number of requests in flight to each backend
+ROUTER_TRACING_ENDPOINT=                OTLP/HTTP endpoint to export OpenTelemetry traces to (tracing is off if empty)
+ROUTER_TRACING_SAMPLE_RATIO=1           Fraction of new traces to sample, between 0 and 1
+ROUTER_ACCESS_LOG=                      File to write access logs to, or STDERR (access logging is off if empty)
+ROUTER_ACCESS_LOG_FORMAT=json           Format of the access log, either json or combined
+ROUTER_ACCESS_LOG_SAMPLE_RATIO=1        Fraction of requests to write to the access log, between 0 and 1
+ROUTER_ACCESS_LOG_STATUSES=             Comma-separated statuses and classes of status (such as 404,5xx) always written to the access log
 
 Timeouts: (values must be parseable by https://pkg.go.dev/time#ParseDuration)
 
@@ -48,6 +71,7 @@ ROUTER_BACKEND_HEADER_TIMEOUT=20s  Timeout for backend response headers to be re
 ROUTER_FRONTEND_READ_TIMEOUT=60s   See https://cs.opensource.google/go/go/+/master:src/net/http/server.go?q=symbol:ReadTimeout
 ROUTER_FRONTEND_WRITE_TIMEOUT=60s  See https://cs.opensource.google/go/go/+/master:src/net/http/server.go?q=symbol:WriteTimeout
 ROUTER_ROUTE_RELOAD_INTERVAL=1m  Interval for periodic route reloads
+ROUTER_REDIRECT_CACHE_DURATION=30m  Default cache lifetime for redirects (0s to prevent caching)
 `
 	fmt.Fprintf(os.Stderr, helpstring, router.VersionInfo(), os.Args[0])
 	const ErrUsage = 64
@@ -79,6 +103,32 @@ func getenvBool(key string, defaultVal bool) (bool, error) {
 	return b, nil
 }
 
+func getenvInt(key string, defaultVal int) (int, error) {
+	str := os.Getenv(key)
+	if str == "" {
+		return defaultVal, nil
+	}
+
+	i, err := strconv.Atoi(str)
+	if err != nil {
+		return 0, err
+	}
+	return i, nil
+}
+
+func getenvFloat(key string, defaultVal float64) (float64, error) {
+	str := os.Getenv(key)
+	if str == "" {
+		return defaultVal, nil
+	}
+
+	f, err := strconv.ParseFloat(str, 64)
+	if err != nil {
+		return 0, err
+	}
+	return f, nil
+}
+
 func mustParseDuration(s string) (d time.Duration) {
 	d, err := time.ParseDuration(s)
 	if err != nil {
@@ -162,6 +212,30 @@ func main() {
 		logger.Fatal().Err(err).Msg("environment variable ROUTER_ENABLE_CONTENT_STORE_UPDATES was not a boolean value")
 	}
 
+	staleCacheMaxBytes, err := getenvInt("ROUTER_STALE_CACHE_MAX_BYTES", 0)
+	if err != nil {
+		logger := zerolog.New(os.Stderr).With().Timestamp().Logger()
+		logger.Fatal().Err(err).Msg("environment variable ROUTER_STALE_CACHE_MAX_BYTES was not an integer value")
+	}
+
+	cacheMaxBytes, err := getenvInt("ROUTER_CACHE_MAX_BYTES", 0)
+	if err != nil {
+		logger := zerolog.New(os.Stderr).With().Timestamp().Logger()
+		logger.Fatal().Err(err).Msg("environment variable ROUTER_CACHE_MAX_BYTES was not an integer value")
+	}
+
+	tracingSampleRatio, err := getenvFloat("ROUTER_TRACING_SAMPLE_RATIO", 1)
+	if err != nil {
+		logger := zerolog.New(os.Stderr).With().Timestamp().Logger()
+		logger.Fatal().Err(err).Msg("environment variable ROUTER_TRACING_SAMPLE_RATIO was not a number")
+	}
+
+	accessLogSampleRatio, err := getenvFloat("ROUTER_ACCESS_LOG_SAMPLE_RATIO", 1)
+	if err != nil {
+		logger := zerolog.New(os.Stderr).With().Timestamp().Logger()
+		logger.Fatal().Err(err).Msg("environment variable ROUTER_ACCESS_LOG_SAMPLE_RATIO was not a number")
+	}
+
 	// Initialize Sentry
 	if err := sentry.Init(sentry.ClientOptions{}); err != nil {
 		panic(err)
@@ -193,11 +267,29 @@ func main() {
 		pubAddr             = getenv("ROUTER_PUBADDR", ":8080")
 		apiAddr             = getenv("ROUTER_APIADDR", ":8081")
 		tlsSkipVerify       = os.Getenv("ROUTER_TLS_SKIP_VERIFY") != ""
+		errorHeader         = os.Getenv("ROUTER_ERROR_HEADER") != ""
+		errorPagesDir       = os.Getenv("ROUTER_ERROR_PAGES_DIR")
+		coalesceRequests    = os.Getenv("ROUTER_COALESCE_REQUESTS") != ""
+		redirectAllowlist   = getenv("ROUTER_REDIRECT_QUERY_ALLOWLIST", "_ga")
+		canonicalRulesFile  = os.Getenv("ROUTER_CANONICAL_RULES_FILE")
+		renderGonePages     = os.Getenv("ROUTER_RENDER_GONE_PAGES") != ""
+		staticFilesDir      = os.Getenv("ROUTER_STATIC_FILES_DIR")
+		headerRulesFile     = os.Getenv("ROUTER_HEADER_RULES_FILE")
+		securityHeadersFile = os.Getenv("ROUTER_SECURITY_HEADERS_FILE")
+		trustRequestID      = os.Getenv("ROUTER_TRUST_REQUEST_ID") != ""
+		trustedProxies      = os.Getenv("ROUTER_TRUSTED_PROXIES")
+		rateLimitsFile      = os.Getenv("ROUTER_RATE_LIMITS_FILE")
+		backendLimitsFile   = os.Getenv("ROUTER_BACKEND_CONCURRENCY_LIMITS_FILE")
+		tracingEndpoint     = os.Getenv("ROUTER_TRACING_ENDPOINT")
+		accessLogFile       = os.Getenv("ROUTER_ACCESS_LOG")
+		accessLogFormat     = getenv("ROUTER_ACCESS_LOG_FORMAT", handlers.AccessLogFormatJSON)
+		accessLogStatuses   = os.Getenv("ROUTER_ACCESS_LOG_STATUSES")
 		beConnTimeout       = getenvDuration("ROUTER_BACKEND_CONNECT_TIMEOUT", "1s")
 		beHeaderTimeout     = getenvDuration("ROUTER_BACKEND_HEADER_TIMEOUT", "20s")
 		feReadTimeout       = getenvDuration("ROUTER_FRONTEND_READ_TIMEOUT", "60s")
 		feWriteTimeout      = getenvDuration("ROUTER_FRONTEND_WRITE_TIMEOUT", "60s")
 		routeReloadInterval = getenvDuration("ROUTER_ROUTE_RELOAD_INTERVAL", "1m")
+		redirectCacheTTL    = getenvDuration("ROUTER_REDIRECT_CACHE_DURATION", "30m")
 	)
 
 	logger.Info().Msgf("frontend read timeout: %v", feReadTimeout)
@@ -209,6 +301,152 @@ func main() {
 		logger.Warn().Msg("skipping verification of TLS certificates; Do not use this option in a production environment.")
 	}
 
+	handlers.RedirectCacheDuration = redirectCacheTTL
+	logger.Info().Msgf("default redirect cache duration: %v", redirectCacheTTL)
+
+	handlers.RedirectQueryAllowlist = nil
+	for _, param := range strings.Split(redirectAllowlist, ",") {
+		if param = strings.TrimSpace(param); param != "" {
+			handlers.RedirectQueryAllowlist = append(handlers.RedirectQueryAllowlist, param)
+		}
+	}
+	logger.Info().Strs("query_allowlist", handlers.RedirectQueryAllowlist).Msg("redirect query parameter allowlist")
+
+	if canonicalRulesFile != "" {
+		canonicalRules, err := handlers.LoadCanonicalRules(canonicalRulesFile)
+		if err != nil {
+			logger.Fatal().Err(err).Msg("failed to load canonicalisation rules")
+		}
+		handlers.Canonical = canonicalRules
+		logger.Info().Int("canonical_host_count", len(canonicalRules.Hosts)).Bool("force_https", canonicalRules.ForceHTTPS).Msgf("loaded canonicalisation rules from %s", canonicalRulesFile)
+	}
+
+	if errorHeader {
+		handlers.EnableRouterErrorHeader = true
+	}
+
+	if errorPagesDir != "" {
+		errorPages, err := handlers.LoadErrorPages(errorPagesDir)
+		if err != nil {
+			logger.Fatal().Err(err).Msg("failed to load error pages")
+		}
+		handlers.ErrorPages = errorPages
+		logger.Info().Int("error_page_count", errorPages.Count()).Msgf("loaded error pages from %s", errorPagesDir)
+	}
+
+	if renderGonePages {
+		handlers.RenderGonePages = true
+		logger.Info().Msg("rendering pages for gone routes with details")
+	}
+
+	if staticFilesDir != "" {
+		if info, err := os.Stat(staticFilesDir); err != nil || !info.IsDir() {
+			logger.Fatal().Err(err).Msgf("static files directory %s is not a directory", staticFilesDir)
+		}
+		handlers.StaticFilesDir = staticFilesDir
+		logger.Info().Msgf("serving static files from %s", staticFilesDir)
+	}
+
+	if headerRulesFile != "" {
+		headerRules, err := handlers.LoadHeaderRules(headerRulesFile)
+		if err != nil {
+			logger.Fatal().Err(err).Msg("failed to load header rules")
+		}
+		handlers.BackendHeaderRules = headerRules
+		logger.Info().Int("backend_count", len(headerRules.Backends)).Msgf("loaded header rules from %s", headerRulesFile)
+	}
+
+	if securityHeadersFile != "" {
+		securityHeaders, err := handlers.LoadSecurityHeaderPolicy(securityHeadersFile)
+		if err != nil {
+			logger.Fatal().Err(err).Msg("failed to load security header policy")
+		}
+		handlers.SecurityHeaders = securityHeaders
+		logger.Info().Int("security_header_count", len(securityHeaders.Headers)).Msgf("loaded security header policy from %s", securityHeadersFile)
+	}
+
+	if trustedProxies != "" {
+		proxies, err := handlers.ParseTrustedProxies(trustedProxies)
+		if err != nil {
+			logger.Fatal().Err(err).Msg("failed to parse trusted proxies")
+		}
+		handlers.TrustedProxies = proxies
+		logger.Info().Int("trusted_proxy_count", len(proxies)).Msg("only trusting forwarding headers from trusted proxies")
+	}
+
+	if backendLimitsFile != "" {
+		concurrencyLimits, err := handlers.LoadConcurrencyLimits(backendLimitsFile)
+		if err != nil {
+			logger.Fatal().Err(err).Msg("failed to load concurrency limits")
+		}
+		handlers.BackendConcurrencyLimits = concurrencyLimits
+		logger.Info().Int("backend_count", len(concurrencyLimits.Backends)).Int("default_max_in_flight", concurrencyLimits.Default.MaxInFlight).Msgf("loaded concurrency limits from %s", backendLimitsFile)
+	}
+
+	if rateLimitsFile != "" {
+		rateLimits, err := handlers.LoadRateLimits(rateLimitsFile)
+		if err != nil {
+			logger.Fatal().Err(err).Msg("failed to load rate limits")
+		}
+		handlers.RateLimits = rateLimits
+		logger.Info().Int("rate_limit_count", len(rateLimits.Limits)).Msgf("loaded rate limits from %s", rateLimitsFile)
+	}
+
+	if trustRequestID {
+		handlers.TrustRequestID = true
+		logger.Info().Msg("using request IDs from incoming requests")
+	}
+
+	if coalesceRequests {
+		handlers.CoalesceRequests = true
+		logger.Info().Msg("coalescing identical concurrent GET requests to backends")
+	}
+
+	if staleCacheMaxBytes > 0 {
+		handlers.StaleResponses = handlers.NewResponseStore(int64(staleCacheMaxBytes))
+		logger.Info().Msgf("serving stale-if-error responses from up to %d bytes of memory", staleCacheMaxBytes)
+	}
+
+	if cacheMaxBytes > 0 {
+		handlers.ResponseCache = handlers.NewResponseStore(int64(cacheMaxBytes))
+		logger.Info().Msgf("caching backend responses in up to %d bytes of memory", cacheMaxBytes)
+	}
+
+	if tracingEndpoint != "" {
+		shutdownTracing, err := router.EnableTracing(context.Background(), tracingEndpoint, tracingSampleRatio)
+		if err != nil {
+			logger.Fatal().Err(err).Msg("failed to enable tracing")
+		}
+		defer func() {
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			if err := shutdownTracing(ctx); err != nil {
+				logger.Warn().Err(err).Msg("failed to flush traces")
+			}
+		}()
+		logger.Info().Float64("sample_ratio", tracingSampleRatio).Msgf("exporting traces to %s", tracingEndpoint)
+	}
+
+	if accessLogFile != "" {
+		var out io.Writer = os.Stderr
+		if !strings.EqualFold(accessLogFile, "STDERR") {
+			f, err := os.OpenFile(accessLogFile, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o644) //nolint:gosec // path is from ROUTER_ACCESS_LOG env var, controlled by user
+			if err != nil {
+				logger.Fatal().Err(err).Msg("failed to open access log")
+			}
+			defer func() {
+				_ = f.Close()
+			}()
+			out = f
+		}
+		accessLog, err := handlers.NewAccessLog(out, accessLogFormat, accessLogSampleRatio, accessLogStatuses)
+		if err != nil {
+			logger.Fatal().Err(err).Msg("failed to create access log")
+		}
+		handlers.AccessLogger = accessLog
+		logger.Info().Str("format", accessLogFormat).Float64("sample_ratio", accessLogSampleRatio).Str("statuses", accessLogStatuses).Msgf("writing access log to %s", accessLogFile)
+	}
+
 	// Setup metrics
 	router.RegisterMetrics(prometheus.DefaultRegisterer)
 
@@ -230,7 +468,7 @@ func main() {
 	serverShutdownChannel := make(chan string, 2)
 
 	// Start Router in a goroutine
-	go listenAndServeOrFatal("routing", pubAddr, rout, feReadTimeout, feWriteTimeout, serverShutdownChannel)
+	go listenAndServeOrFatal("routing", pubAddr, handlers.TraceRequests(rout), feReadTimeout, feWriteTimeout, serverShutdownChannel)
 	logger.Info().Msgf("listening for requests on %v", pubAddr)
 
 	// Create the API server handler
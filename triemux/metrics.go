@@ -12,6 +12,14 @@ var (
 		},
 	)
 
+	caseRedirectCountMetric = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "router_triemux_case_redirect_total",
+			Help: "Number of redirects to lowercase paths, by the first segment of the lowercase path if it has a route",
+		},
+		[]string{"prefix"},
+	)
+
 	internalServiceUnavailableCountMetric = prometheus.NewCounter(
 		prometheus.CounterOpts{
 			Name: "router_service_unavailable_error_total",
@@ -23,6 +31,7 @@ var (
 func RegisterMetrics(r prometheus.Registerer) {
 	r.MustRegister(
 		entryNotFoundCountMetric,
+		caseRedirectCountMetric,
 		internalServiceUnavailableCountMetric,
 	)
 }
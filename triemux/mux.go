@@ -5,6 +5,7 @@ package triemux
 
 import (
 	"net/http"
+	"net/url"
 	"regexp"
 	"strings"
 	"sync"
@@ -34,25 +35,38 @@ func NewMux(logger zerolog.Logger) *Mux {
 }
 
 // ServeHTTP forwards the request to a backend with a registered route matching
-// the request path. Serves 404 when there is no backend. Serves 301 redirect
-// to lowercase path when the URL path is entirely uppercase. Serves 503 when
-// no routes are loaded.
+// the request path. Serves 404 when there is no backend. Redirects to the
+// canonical host, scheme and path when canonicalisation rules are configured.
+// Serves 301 redirect to lowercase path when the URL path is entirely
+// uppercase, or according to the case policy in the canonicalisation rules.
+// Serves 503 when no routes are loaded.
 func (mux *Mux) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	if mux.count == 0 {
-		w.WriteHeader(http.StatusServiceUnavailable)
+		if !handlers.ServeErrorPage(w, r, http.StatusServiceUnavailable) {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
 		mux.logger.Error().Msg("route table is empty")
 		internalServiceUnavailableCountMetric.Inc()
 		return
 	}
 
-	if shouldRedirToLowercasePath(r.URL.Path) {
+	if handlers.ServeCanonicalRedirect(w, r) {
+		return
+	}
+
+	if mux.caseRedirect(r.URL.Path) {
+		caseRedirectCountMetric.WithLabelValues(mux.caseRedirectPrefix(strings.ToLower(r.URL.Path))).Inc()
 		mux.downcaser.ServeHTTP(w, r)
 		return
 	}
 
-	handler, ok := mux.lookup(r.URL.Path)
+	handler, ok := handlers.TraceRouteLookup(r, func() (http.Handler, bool) {
+		return mux.lookup(r.URL.Path)
+	})
 	if !ok {
-		http.NotFound(w, r)
+		if !handlers.ServeErrorPage(w, r, http.StatusNotFound) {
+			http.NotFound(w, r)
+		}
 		return
 	}
 	handler.ServeHTTP(w, r)
@@ -70,8 +84,91 @@ func shouldRedirToLowercasePath(path string) (match bool) {
 	return reShouldRedirect.MatchString(path)
 }
 
+// caseRedirect reports whether a request for path should be redirected to its
+// lowercase form under the case policy. Routes are only looked up for the
+// mixed mode rule.
+func (mux *Mux) caseRedirect(path string) bool {
+	policy := handlers.CaseRules()
+	if policy.Mode == handlers.CaseModeOff || policy.Exempt(path) {
+		return false
+	}
+	if shouldRedirToLowercasePath(path) {
+		return true
+	}
+	if policy.Mode != handlers.CaseModeMixed {
+		return false
+	}
+
+	lowercasePath := strings.ToLower(path)
+	if lowercasePath == path {
+		return false
+	}
+	if _, routed := mux.find(lowercasePath); !routed {
+		return false
+	}
+	_, routed := mux.find(path)
+	return !routed
+}
+
+// caseRedirectPrefix returns the label a case redirect to lowercasePath is
+// counted under: its first segment if it has a route, other than a prefix
+// route for the whole site, or "other" otherwise. This keeps the values of
+// the label to the first segments of routes.
+func (mux *Mux) caseRedirectPrefix(lowercasePath string) string {
+	segments := splitPath(lowercasePath)
+	if len(segments) == 0 {
+		return "other"
+	}
+
+	mux.mu.RLock()
+	defer mux.mu.RUnlock()
+
+	_, routed := mux.exactTrie.Get(segments)
+	for i := len(segments); !routed && i > 0; i-- {
+		_, routed = mux.prefixTrie.Get(segments[:i])
+	}
+	if !routed {
+		return "other"
+	}
+	return "/" + segments[0]
+}
+
+// Resolve returns the handler that ServeHTTP would pass a request for the
+// escaped path to, after following the redirects it makes to the canonical
+// path and to the lowercase path, without counting anything in metrics. If
+// there isn't one, it returns the status that ServeHTTP would respond with:
+// 400 if the path is rejected, or 404 if it isn't routed. Hosts and schemes
+// aren't taken into account.
+func (mux *Mux) Resolve(path string) (http.Handler, int) {
+	path, ok := handlers.CanonicalPath(path)
+	if !ok {
+		return nil, http.StatusBadRequest
+	}
+	path, err := url.PathUnescape(path)
+	if err != nil {
+		return nil, http.StatusBadRequest
+	}
+	if mux.caseRedirect(path) {
+		path = strings.ToLower(path)
+	}
+	handler, ok := mux.find(path)
+	if !ok {
+		return nil, http.StatusNotFound
+	}
+	return handler, http.StatusOK
+}
+
 // lookup finds a URL path in the Mux and returns the corresponding handler.
 func (mux *Mux) lookup(path string) (handler http.Handler, ok bool) {
+	if handler, ok = mux.find(path); !ok {
+		entryNotFoundCountMetric.Inc()
+		return nil, false
+	}
+	return
+}
+
+// find is lookup without counting paths that aren't found.
+func (mux *Mux) find(path string) (handler http.Handler, ok bool) {
 	mux.mu.RLock()
 	defer mux.mu.RUnlock()
 
@@ -79,10 +176,6 @@ func (mux *Mux) lookup(path string) (handler http.Handler, ok bool) {
 	if handler, ok = mux.exactTrie.Get(pathSegments); !ok {
 		handler, ok = mux.prefixTrie.GetLongestPrefix(pathSegments)
 	}
-	if !ok {
-		entryNotFoundCountMetric.Inc()
-		return nil, false
-	}
 	return
 }
 
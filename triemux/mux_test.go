@@ -3,12 +3,15 @@ package triemux
 import (
 	"math/rand"
 	"net/http"
+	"net/http/httptest"
 	"os"
 	"strings"
 	"testing"
 
 	promtest "github.com/prometheus/client_golang/prometheus/testutil"
 	"github.com/rs/zerolog"
+
+	"github.com/alphagov/router/handlers"
 )
 
 func TestSplitPath(t *testing.T) {
@@ -240,6 +243,78 @@ func TestRouteCount(t *testing.T) {
 	}
 }
 
+func TestServeHTTPCanonicalRedirect(t *testing.T) {
+	handlers.Canonical = &handlers.CanonicalRules{
+		Hosts:        map[string]string{"gov.uk": "www.gov.uk"},
+		RedirectCode: http.StatusMovedPermanently,
+	}
+	defer func() { handlers.Canonical = nil }()
+
+	mux := NewMux(zerolog.Nop())
+	mux.Handle("/foo", false, a)
+
+	rr := httptest.NewRecorder()
+	mux.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "http://gov.uk/FOO", nil))
+
+	if rr.Code != http.StatusMovedPermanently {
+		t.Errorf("Expected status 301, got %d", rr.Code)
+	}
+	if location := rr.Header().Get("Location"); location != "http://www.gov.uk/FOO" {
+		t.Errorf("Expected redirect to canonical host before other redirects, got %q", location)
+	}
+}
+
+func TestServeHTTPCasePolicy(t *testing.T) {
+	defer func() { handlers.Canonical = nil }()
+
+	mux := NewMux(zerolog.Nop())
+	mux.Handle("/government/publications", true, a)
+	mux.Handle("/Government/Consultations", false, b)
+	mux.Handle("/uploads", true, c)
+
+	tests := []struct {
+		mode     string
+		path     string
+		location string
+	}{
+		{handlers.CaseModeUppercase, "/GOVERNMENT/PUBLICATIONS", "/government/publications"},
+		{handlers.CaseModeUppercase, "/Government/Publications", ""},
+		{handlers.CaseModeMixed, "/Government/Publications", "/government/publications"},
+		{handlers.CaseModeMixed, "/Government/Consultations", ""},
+		{handlers.CaseModeMixed, "/Unrouted/Path", ""},
+		{handlers.CaseModeMixed, "/Uploads/File.PDF", ""},
+		{handlers.CaseModeMixed, "/UPLOADS/FILE.PDF", ""},
+		{handlers.CaseModeOff, "/GOVERNMENT/PUBLICATIONS", ""},
+	}
+
+	for _, ex := range tests {
+		handlers.Canonical = &handlers.CanonicalRules{
+			Case: handlers.CasePolicy{Mode: ex.mode, ExemptPrefixes: []string{"/uploads/"}},
+		}
+
+		rr := httptest.NewRecorder()
+		mux.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, ex.path, nil))
+
+		if location := rr.Header().Get("Location"); location != ex.location {
+			t.Errorf("%s mode: expected %s to redirect to %q, got %q", ex.mode, ex.path, ex.location, location)
+		}
+	}
+
+	handlers.Canonical = &handlers.CanonicalRules{Case: handlers.CasePolicy{Mode: handlers.CaseModeMixed}}
+	mux.Handle("/", true, c)
+	for path, prefix := range map[string]string{
+		"/GOVERNMENT/PUBLICATIONS/FOO": "/government",
+		"/UNROUTED/PATH":               "other",
+	} {
+		before := promtest.ToFloat64(caseRedirectCountMetric.WithLabelValues(prefix))
+		mux.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, path, nil))
+		after := promtest.ToFloat64(caseRedirectCountMetric.WithLabelValues(prefix))
+		if after-before != 1 {
+			t.Errorf("Expected case redirect count for %s to increase by 1 for %s, got %v", prefix, path, after-before)
+		}
+	}
+}
+
 func loadStrings(filename string) []string {
 	content, err := os.ReadFile(filename) //gosec:disable G304 -- We intentionally want to read a file from a variable
 	if err != nil {